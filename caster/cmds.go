@@ -1,23 +1,52 @@
 package caster
 
 import (
-	"log"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/progrium/tapecafe/ffmpeg"
 )
 
+// IsCommand reports whether name is a slash command the caster handles.
+func IsCommand(name string) bool {
+	_, ok := cmds(&Session{Filename: "-"})[name]
+	return ok
+}
+
 func cmds(sess *Session) map[string]func([]string) error {
 	if sess.Filename == "" {
 		return map[string]func([]string) error{}
 	}
 	slashYouTube := func(args []string) error {
-		sess.pause()
+		if len(args) == 0 {
+			return fmt.Errorf("usage: /youtube <url>")
+		}
+		sess.unschedule()
+		sess.stopCountdown()
+		if err := sess.showSlate(StatusDownload, ""); err != nil {
+			return err
+		}
 		sess.setStatus(StatusDownload)
-		filename, err := DownloadYoutubeVideo(args[0])
+		var (
+			filename string
+			err      error
+		)
+		// other commands run meanwhile, and take over from the download
+		sess.unlocked(func() {
+			filename, err = DownloadYoutubeVideo(args[0], func(percent int) {
+				if sess.downloading() {
+					sess.showSlate(StatusDownload, fmt.Sprintf("%d%%", percent))
+				}
+			})
+		})
 		if err != nil {
 			return err
 		}
+		if !sess.downloading() {
+			return fmt.Errorf("download of %s superseded", args[0])
+		}
 		title, err := ffmpeg.FileTitle(filename)
 		if err != nil {
 			return err
@@ -40,9 +69,41 @@ func cmds(sess *Session) map[string]func([]string) error {
 		if err != nil {
 			return err
 		}
-		log.Println("starting ffmpeg process at", startTime)
+		sess.log.Debug("starting ffmpeg", "position", startTime)
 		return sess.play(startMs)
 	}
+	slashPlay := func(args []string) error {
+		countdown := sess.Countdown
+		var rest []string
+		for i := 0; i < len(args); i++ {
+			if args[i] == "--countdown" && i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil {
+					return fmt.Errorf("invalid countdown: %s", args[i+1])
+				}
+				countdown = n
+				i++
+				continue
+			}
+			rest = append(rest, args[i])
+		}
+		sess.mu.Lock()
+		status := sess.State.Status
+		sess.mu.Unlock()
+		if countdown <= 0 || status == StatusPlaying {
+			return slashPlaySeek(rest)
+		}
+		startTime := sess.State.Position
+		if len(rest) > 0 {
+			startTime = rest[0]
+		}
+		startMs, err := ffmpeg.ParseTimeToMs(startTime)
+		if err != nil {
+			return err
+		}
+		sess.log.Debug("starting countdown", "seconds", countdown, "position", startTime)
+		return sess.countdown(countdown, startMs)
+	}
 	slashPause := func(args []string) error {
 		return sess.pause()
 	}
@@ -50,10 +111,6 @@ func cmds(sess *Session) map[string]func([]string) error {
 		return sess.stop()
 	}
 	slashBack := func(args []string) error {
-		if err := sess.FFmpeg.Stop(); err != nil {
-			sess.setStatus(StatusError)
-			return err
-		}
 		backTime := "00:10"
 		if len(args) > 0 {
 			if strings.Contains(args[0], ":") {
@@ -74,14 +131,9 @@ func cmds(sess *Session) map[string]func([]string) error {
 		}
 		sess.mu.Unlock()
 
-		log.Println("seeking back to", sess.State.Position)
 		return sess.seek(newPosMs)
 	}
 	slashForward := func(args []string) error {
-		if err := sess.FFmpeg.Stop(); err != nil {
-			sess.setStatus(StatusError)
-			return err
-		}
 		forwardTime := "00:10"
 		if len(args) > 0 {
 			if strings.Contains(args[0], ":") {
@@ -99,11 +151,34 @@ func cmds(sess *Session) map[string]func([]string) error {
 		newPosMs := sess.State.PositionMs + forwardMs
 		sess.mu.Unlock()
 
-		log.Println("seeking forward to", sess.State.Position)
 		return sess.seek(newPosMs)
 	}
+	slashVolume := func(args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: /volume <dB|%%>")
+		}
+		db, err := ffmpeg.ParseGainDb(args[0])
+		if err != nil {
+			return err
+		}
+		sess.log.Debug("setting volume", "volume", ffmpeg.FormatGainDb(db))
+		return sess.setVolume(db)
+	}
+	slashSchedule := func(args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: /schedule <time>")
+		}
+		at, err := ParseStartTime(strings.Join(args, " "), time.Now())
+		if err != nil {
+			return err
+		}
+		return sess.Schedule(at)
+	}
+	slashUnschedule := func(args []string) error {
+		return sess.Unschedule()
+	}
 	return map[string]func([]string) error{
-		"/play":    slashPlaySeek,
+		"/play":    slashPlay,
 		"/seek":    slashPlaySeek,
 		"/pause":   slashPause,
 		"/back":    slashBack,
@@ -113,5 +188,10 @@ func cmds(sess *Session) map[string]func([]string) error {
 		"/youtube": slashYouTube,
 		"/stop":    slashStop,
 		"/eject":   slashStop,
+		"/volume":  slashVolume,
+		"/vol":     slashVolume,
+
+		"/schedule":   slashSchedule,
+		"/unschedule": slashUnschedule,
 	}
 }
@@ -0,0 +1,15 @@
+package caster
+
+import (
+	"log/slog"
+	"testing"
+)
+
+func TestCommandsNeedArgs(t *testing.T) {
+	s := &Session{Filename: "tape.mp4", log: slog.Default()}
+	for _, cmd := range []string{"/youtube", "/yt", "/volume", "/schedule"} {
+		if err := s.runCommand("test", []string{cmd}); err == nil {
+			t.Errorf("%s without args succeeded", cmd)
+		}
+	}
+}
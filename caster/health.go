@@ -0,0 +1,98 @@
+package caster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/progrium/tapecafe/ffmpeg"
+)
+
+// Health describes whether the caster's machine keeps up with the stream,
+// judged over the last few seconds of ffmpeg progress.
+type Health struct {
+	OK          bool
+	Speed       float64
+	FPS         float64
+	BitrateKbps float64
+	DropFrames  int
+	DupFrames   int
+	Problems    []string `json:",omitempty"`
+}
+
+const (
+	// healthWindow is how many progress reports are judged, about 5 seconds.
+	healthWindow = 10
+	// minSpeed is the encoding speed below which playback falls behind.
+	minSpeed = 0.95
+	// bitrateCollapse is the fraction of the usual bitrate that counts as
+	// having collapsed.
+	bitrateCollapse = 0.25
+)
+
+type progressSample struct {
+	ffmpeg.Progress
+	at time.Time
+}
+
+// healthMonitor keeps a window of progress reports for the current run.
+type healthMonitor struct {
+	run          int
+	samples      []progressSample
+	baselineKbps float64
+}
+
+func (m *healthMonitor) update(run int, p ffmpeg.Progress) *Health {
+	if run != m.run {
+		m.run, m.samples, m.baselineKbps = run, nil, 0
+	}
+	if p.OutTimeMs < 0 {
+		return nil
+	}
+	m.samples = append(m.samples, progressSample{p, time.Now()})
+	if len(m.samples) > healthWindow {
+		m.samples = m.samples[1:]
+	}
+
+	h := &Health{
+		OK:          true,
+		Speed:       p.Speed,
+		FPS:         p.FPS,
+		BitrateKbps: p.BitrateKbps,
+		DropFrames:  p.DropFrames,
+		DupFrames:   p.DupFrames,
+	}
+	first := m.samples[0]
+	elapsed := time.Since(first.at)
+	mediaMs := p.OutTimeMs - first.OutTimeMs
+	if elapsed <= 0 || mediaMs <= 0 {
+		return h
+	}
+	// ffmpeg reports speed and bitrate averaged since the start of the run,
+	// which hides a recent slowdown, so measure them over the window
+	h.Speed = float64(mediaMs) / float64(elapsed.Milliseconds())
+	if p.TotalSize > 0 {
+		h.BitrateKbps = float64(p.TotalSize-first.TotalSize) * 8 / float64(mediaMs)
+	}
+	if len(m.samples) < healthWindow {
+		// still warming up, seeking decodes ahead faster than realtime
+		return h
+	}
+
+	if h.Speed < minSpeed {
+		h.Problems = append(h.Problems, fmt.Sprintf("encoding at %.2fx, slower than realtime", h.Speed))
+	}
+	if drops := p.DropFrames - first.DropFrames; drops > 0 {
+		h.Problems = append(h.Problems, fmt.Sprintf("dropped %d frames", drops))
+	}
+	if p.TotalSize > 0 {
+		if m.baselineKbps > 0 && h.BitrateKbps < m.baselineKbps*bitrateCollapse {
+			h.Problems = append(h.Problems, fmt.Sprintf("bitrate fell to %.0f kbit/s from %.0f kbit/s", h.BitrateKbps, m.baselineKbps))
+		} else if m.baselineKbps == 0 {
+			m.baselineKbps = h.BitrateKbps
+		} else {
+			m.baselineKbps = 0.9*m.baselineKbps + 0.1*h.BitrateKbps
+		}
+	}
+	h.OK = len(h.Problems) == 0
+	return h
+}
@@ -0,0 +1,63 @@
+package caster
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	downloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tapecafe_caster_download_bytes_total",
+		Help: "Bytes downloaded for /youtube.",
+	})
+	downloadSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tapecafe_caster_download_seconds_total",
+		Help: "Time spent downloading for /youtube. Throughput is the rate of bytes over the rate of this.",
+	})
+)
+
+// Collectors returns metrics about the session for a registry.
+func (s *Session) Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		downloadBytes,
+		downloadSeconds,
+		s.seekLatency,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tapecafe_caster_encode_speed",
+			Help: "Encoding speed relative to realtime over the last few seconds, 0 when not streaming.",
+		}, func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.State.Health == nil {
+				return 0
+			}
+			return s.State.Health.Speed
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tapecafe_caster_dropped_frames",
+			Help: "Frames dropped by the current ffmpeg run.",
+		}, func() float64 {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.State.Health == nil {
+				return 0
+			}
+			return float64(s.State.Health.DropFrames)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "tapecafe_caster_ffmpeg_restarts_total",
+			Help: "Times ffmpeg was started, for every play, seek, slate and countdown.",
+		}, func() float64 {
+			s.FFmpeg.Lock()
+			defer s.FFmpeg.Unlock()
+			return float64(s.FFmpeg.Run)
+		}),
+	}
+}
+
+func newSeekLatency() prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "tapecafe_caster_seek_latency_seconds",
+		Help:    "Time from starting ffmpeg at a position until it reports streaming.",
+		Buckets: []float64{0.25, 0.5, 1, 2, 4, 8, 16},
+	})
+}
@@ -0,0 +1,136 @@
+package caster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/progrium/tapecafe/ffmpeg"
+)
+
+// SavedState is what gets persisted for a room so a restarted caster can
+// pick up where it left off.
+type SavedState struct {
+	Filename   string
+	Title      string
+	PositionMs int
+	VolumeDb   float64
+	Playing    bool
+	SavedAt    time.Time
+}
+
+func statePath(room string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "tapecafe", "sessions", room+".json"), nil
+}
+
+// LoadState returns the last saved state for room, or nil if there is none.
+func LoadState(room string) (*SavedState, error) {
+	path, err := statePath(room)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var saved SavedState
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// SaveState persists the session state, or removes it once the tape is ejected.
+func (s *Session) SaveState() error {
+	path, err := statePath(s.Room)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	saved := SavedState{
+		Filename:   s.Filename,
+		Title:      s.State.Title,
+		PositionMs: s.State.PositionMs,
+		VolumeDb:   s.State.VolumeDb,
+		SavedAt:    time.Now(),
+	}
+	switch s.State.Status {
+	case StatusPlaying, StatusStarting, StatusSeeking, StatusFwd, StatusBack:
+		saved.Playing = true
+	}
+	s.mu.Unlock()
+	if saved.Filename == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if saved.Filename, err = filepath.Abs(saved.Filename); err != nil {
+		return err
+	}
+	b, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Resume restores volume and position from saved, playing again if it was
+// playing when saved. The session must already be started.
+func (s *Session) Resume(saved *SavedState) error {
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+	s.FFmpeg.Lock()
+	s.FFmpeg.Options.GainDb = saved.VolumeDb
+	s.FFmpeg.Unlock()
+	s.mu.Lock()
+	s.State.VolumeDb = saved.VolumeDb
+	s.State.Volume = ffmpeg.FormatGainDb(saved.VolumeDb)
+	s.State.PositionMs = saved.PositionMs
+	s.State.Position = ffmpeg.FormatTimeMs(saved.PositionMs)
+	s.mu.Unlock()
+	s.log.Info("resuming", "file", saved.Filename, "position", ffmpeg.FormatTimeMs(saved.PositionMs))
+	if saved.Playing {
+		return s.play(saved.PositionMs)
+	}
+	return s.sendState()
+}
+
+func (s *Session) persist(ctx context.Context) {
+	defer close(s.persisted)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		finished := s.State.Status == StatusFinished && s.Filename != ""
+		s.mu.Unlock()
+		if finished {
+			continue
+		}
+		if err := s.SaveState(); err != nil {
+			s.log.Error("save state", "err", err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package caster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/progrium/tapecafe/ffmpeg"
+)
+
+var clockLayouts = []string{"15:04", "15:04:05", "3:04pm", "3pm"}
+
+// ParseStartTime parses a wall-clock time like "20:00" or "8pm" as the next
+// occurrence after now, a relative duration like "+10m", or an RFC 3339 time.
+func ParseStartTime(s string, now time.Time) (time.Time, error) {
+	if strings.HasPrefix(s, "+") {
+		d, err := time.ParseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid start time: %s", s)
+		}
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range clockLayouts {
+		c, err := time.ParseInLocation(layout, strings.ToLower(s), now.Location())
+		if err != nil {
+			continue
+		}
+		t := time.Date(now.Year(), now.Month(), now.Day(), c.Hour(), c.Minute(), c.Second(), 0, now.Location())
+		if !t.After(now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid start time: %s", s)
+}
+
+// Schedule arms the session to start playing at the given time, publishing
+// the time remaining until then. It replaces any previous schedule, and only
+// schedules a loaded tape that is ready or paused.
+func (s *Session) Schedule(at time.Time) error {
+	s.mu.Lock()
+	status, filename := s.State.Status, s.Filename
+	s.mu.Unlock()
+	if filename == "" {
+		return fmt.Errorf("no tape to schedule")
+	}
+	if status != StatusReady && status != StatusPaused && !strings.HasPrefix(string(status), string(StatusScheduled)) {
+		return fmt.Errorf("can only schedule a tape that is ready or paused")
+	}
+	s.unschedule()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancelSchedule = cancel
+	if status == StatusReady || status == StatusPaused {
+		s.scheduledFrom = status
+	}
+	s.State.StartsAt = at.Format(time.RFC3339)
+	s.mu.Unlock()
+	s.log.Info("scheduled", "at", at.Format(time.RFC3339))
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			// the ticker may have fired as Unschedule canceled
+			if ctx.Err() != nil {
+				return
+			}
+			remainingMs := int(time.Until(at).Milliseconds())
+			s.mu.Lock()
+			startMs := s.State.PositionMs
+			s.mu.Unlock()
+			var err error
+			switch {
+			case remainingMs <= 0:
+				err = s.runTimed(ctx, func() error {
+					return s.play(startMs)
+				})
+			case s.Countdown > 0 && remainingMs <= s.Countdown*1000:
+				err = s.runTimed(ctx, func() error {
+					s.unschedule()
+					if err := s.countdown((remainingMs+999)/1000, startMs); err != nil {
+						return err
+					}
+					s.mu.Lock()
+					s.countScheduled = true
+					s.mu.Unlock()
+					return nil
+				})
+			default:
+				status := Status(fmt.Sprintf("%s %s", StatusScheduled, ffmpeg.FormatTimeMs(remainingMs+999)))
+				// unschedule waits for this, so it can't be overwritten
+				// after the schedule is canceled
+				s.scheduleMu.Lock()
+				if ctx.Err() != nil {
+					s.scheduleMu.Unlock()
+					return
+				}
+				if err := s.showSlate(status, ""); err != nil {
+					s.log.Error("schedule slate", "err", err)
+				}
+				s.setStatus(status)
+				s.scheduleMu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				continue
+			}
+			if err != nil {
+				s.log.Error("schedule play", "err", err)
+			}
+			return
+		}
+	}()
+	return nil
+}
+
+// Unschedule cancels a scheduled start, including the countdown it started,
+// returning to the status the tape was scheduled from.
+func (s *Session) Unschedule() error {
+	s.mu.Lock()
+	status, counting := s.scheduledFrom, s.countScheduled
+	s.mu.Unlock()
+	if !s.unschedule() && !(counting && s.stopCountdown()) {
+		return fmt.Errorf("nothing scheduled")
+	}
+	if status == "" {
+		status = StatusReady
+	}
+	if err := s.showSlate(status, ""); err != nil {
+		return err
+	}
+	return s.setStatus(status)
+}
+
+func (s *Session) unschedule() bool {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelSchedule == nil {
+		return false
+	}
+	s.cancelSchedule()
+	s.cancelSchedule = nil
+	s.State.StartsAt = ""
+	return true
+}
@@ -0,0 +1,56 @@
+package caster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseStartTime(t *testing.T) {
+	now := time.Date(2024, 3, 9, 19, 30, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "+10m", want: now.Add(10 * time.Minute)},
+		{in: "+1h30m", want: now.Add(90 * time.Minute)},
+		{in: "20:00", want: time.Date(2024, 3, 9, 20, 0, 0, 0, time.UTC)},
+		{in: "20:00:30", want: time.Date(2024, 3, 9, 20, 0, 30, 0, time.UTC)},
+		{in: "8pm", want: time.Date(2024, 3, 9, 20, 0, 0, 0, time.UTC)},
+		{in: "8:15PM", want: time.Date(2024, 3, 9, 20, 15, 0, 0, time.UTC)},
+		{in: "9am", want: time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{in: "19:30", want: time.Date(2024, 3, 10, 19, 30, 0, 0, time.UTC)},
+		{in: "2024-03-10T12:00:00Z", want: time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{in: "+soon", wantErr: true},
+		{in: "25:00", wantErr: true},
+		{in: "tonight", wantErr: true},
+	} {
+		got, err := ParseStartTime(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStartTime(%q) err = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseStartTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleNeedsReadyTape(t *testing.T) {
+	at := time.Now().Add(time.Hour)
+	for _, tt := range []struct {
+		name     string
+		filename string
+		status   Status
+	}{
+		{"no tape", "", StatusReady},
+		{"playing", "tape.mp4", StatusPlaying},
+		{"counting down", "tape.mp4", countdownStatus(3)},
+	} {
+		s := &Session{Filename: tt.filename}
+		s.State.Status = tt.status
+		if err := s.Schedule(at); err == nil {
+			t.Errorf("%s: Schedule succeeded", tt.name)
+		}
+	}
+}
@@ -2,36 +2,80 @@ package caster
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	lksdk2 "github.com/livekit/server-sdk-go/v2"
 	"github.com/progrium/tapecafe/ffmpeg"
+	"github.com/progrium/tapecafe/server"
+	"github.com/progrium/tapecafe/ui"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/xid"
 	"golang.org/x/net/websocket"
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
 	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/talk"
 )
 
 type Session struct {
-	Room         string
-	Filename     string
-	ServerURL    url.URL
+	// ID identifies this run of the caster in logs.
+	ID        string
+	Room      string
+	Filename  string
+	ServerURL url.URL
+	// LocalIngress is where ffmpeg publishes to, a local RTMP tunnel to the
+	// server, the server's WHIP endpoint with the WHIP protocol, or with the
+	// WebRTC protocol, local listeners feeding tracks published by the caster.
 	LocalIngress url.URL
 	State        SharedState
 	FFmpeg       *ffmpeg.Runner
-
-	rpc *rpc.Client
-	mu  sync.Mutex
+	// Protocol is used to publish the stream, ProtocolRTMP or ProtocolWHIP
+	// through an ingress, or ProtocolWebRTC to publish tracks directly.
+	Protocol string
+	// Countdown is the default length in seconds of the leader before /play.
+	Countdown int
+
+	rpc            *talk.Peer
+	log            *slog.Logger
+	health         healthMonitor
+	seekLatency    prometheus.Histogram
+	seekRun        int
+	seekAt         time.Time
+	lkRoom         *lksdk2.Room
+	tracks         []*trackSource
+	ingress        net.Listener
+	cancelSchedule context.CancelFunc
+	scheduleMu     sync.Mutex
+	cancelCount    context.CancelFunc
+	// scheduledFrom is the status a schedule returns to when canceled, and
+	// countScheduled whether the countdown in progress was started by one
+	scheduledFrom  Status
+	countScheduled bool
+	// stopPersist stops the periodic saves, closing persisted once they stop
+	stopPersist context.CancelFunc
+	persisted   chan struct{}
+	// cmdMu serializes commands from chat, the API and timers
+	cmdMu sync.Mutex
+	mu    sync.Mutex
 }
 
-func dialRPC(baseURL url.URL, room string) (*rpc.Client, error) {
+const (
+	ProtocolRTMP   = "rtmp"
+	ProtocolWHIP   = "whip"
+	ProtocolWebRTC = "webrtc"
+)
+
+func dialRPC(baseURL url.URL, room, session string) (*talk.Peer, error) {
 	rpcURL := baseURL
 	rpcURL.Path = "/-/cast/rpc"
 
@@ -45,13 +89,13 @@ func dialRPC(baseURL url.URL, room string) (*rpc.Client, error) {
 
 	var ws *websocket.Conn
 	var err error
-	ws, err = websocket.Dial(rpcURL.String()+"?room="+room, "", originURL.String())
+	ws, err = websocket.Dial(rpcURL.String()+"?room="+room+"&session="+session, "", originURL.String())
 	if err != nil {
 		return nil, err
 
 	}
 	ws.PayloadType = websocket.BinaryFrame
-	return rpc.NewClient(mux.New(ws), codec.CBORCodec{}), nil
+	return talk.NewPeer(mux.New(ws), codec.CBORCodec{}), nil
 }
 
 func New(serverURL, room, filename, title string) (*Session, error) {
@@ -70,7 +114,8 @@ func New(serverURL, room, filename, title string) (*Session, error) {
 	}
 	u.Path = ""
 
-	client, err := dialRPC(*u, room)
+	id := xid.New().String()
+	client, err := dialRPC(*u, room, id)
 	if err != nil {
 		return nil, fmt.Errorf("dial RPC: %w", err)
 	}
@@ -85,7 +130,9 @@ func New(serverURL, room, filename, title string) (*Session, error) {
 		}
 	}
 
-	return &Session{
+	logger := slog.Default().With("room", room, "session", id)
+	sess := &Session{
+		ID:        id,
 		Room:      room,
 		Filename:  filename,
 		ServerURL: *u,
@@ -93,10 +140,16 @@ func New(serverURL, room, filename, title string) (*Session, error) {
 			Title:    title,
 			Status:   StatusInit,
 			Position: ffmpeg.FormatTimeMs(0),
+			Volume:   ffmpeg.FormatGainDb(0),
 		},
-		FFmpeg: ffmpeg.NewRunner(),
-		rpc:    client,
-	}, nil
+		FFmpeg:      ffmpeg.NewRunner(),
+		Protocol:    ProtocolRTMP,
+		rpc:         client,
+		log:         logger,
+		seekLatency: newSeekLatency(),
+	}
+	sess.FFmpeg.Options.Logger = logger.With("component", "ffmpeg")
+	return sess, nil
 }
 
 func (s *Session) Start() error {
@@ -115,11 +168,35 @@ func (s *Session) Start() error {
 		return err
 	}
 
+	s.rpc.Handle("caster.cmd", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var args []string
+		if err := c.Receive(&args); err != nil {
+			r.Return(err)
+			return
+		}
+		if err := s.runCommand("api", args); err != nil {
+			s.log.Error("command", "command", args[0], "participant", "api", "err", err)
+			r.Return(err)
+			return
+		}
+		s.mu.Lock()
+		state := s.State
+		s.mu.Unlock()
+		r.Return(state)
+	}))
+	go s.rpc.Respond()
+
 	if s.Filename != "" {
 		if err := s.loadFile(); err != nil {
 			return err
 		}
 		go s.handleProgress()
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopPersist, s.persisted = cancel, make(chan struct{})
+		go s.persist(ctx)
+		if err := s.showSlate(StatusReady, ""); err != nil {
+			return err
+		}
 		return s.setStatus(StatusReady)
 	}
 
@@ -127,8 +204,39 @@ func (s *Session) Start() error {
 	return s.setStatus(StatusPlaying)
 }
 
-func (s *Session) Shutdown() error {
+// Shutdown saves the session, stops ffmpeg and tells the room the tape was
+// ejected before disconnecting, giving up on anything pending once ctx is done.
+func (s *Session) Shutdown(ctx context.Context) error {
+	s.unschedule()
+	s.stopCountdown()
+	// the final save mustn't be overwritten by a periodic one
+	if s.stopPersist != nil {
+		s.stopPersist()
+		<-s.persisted
+	}
+	if err := s.SaveState(); err != nil {
+		s.log.Error("save state", "err", err)
+	}
+	if err := s.FFmpeg.Shutdown(ctx); err != nil {
+		s.log.Warn("stop ffmpeg", "err", err)
+	}
 	s.setStatus(StatusFinished)
+	if _, err := s.rpc.Call(ctx, "cast.say", "⏏ The caster has left, the tape is ejected."); err != nil {
+		s.log.Warn("chat notice", "err", err)
+	}
+
+	s.mu.Lock()
+	ingress, lkRoom, tracks := s.ingress, s.lkRoom, s.tracks
+	s.mu.Unlock()
+	if ingress != nil {
+		ingress.Close()
+	}
+	if lkRoom != nil {
+		lkRoom.Disconnect()
+	}
+	for _, track := range tracks {
+		track.Close()
+	}
 	return s.rpc.Close()
 }
 
@@ -144,10 +252,41 @@ func (s *Session) loadFile() error {
 
 	s.State.LengthMs = dur
 	s.State.Length = ffmpeg.FormatTimeMs(dur)
+	s.State.Storyboard = nil
+
+	go func(filename string) {
+		if _, err := ffmpeg.KeyframeIndex(filename); err != nil {
+			s.log.Warn("keyframe index", "file", filename, "err", err)
+		}
+		if err := s.uploadStoryboard(filename, dur); err != nil {
+			s.log.Warn("storyboard", "file", filename, "err", err)
+		}
+	}(s.Filename)
 
 	return nil
 }
 
+// uploadStoryboard generates a storyboard for filename and uploads it to the
+// server, advertising where it is served in the shared state.
+func (s *Session) uploadStoryboard(filename string, durationMs int) error {
+	image, sb, err := ffmpeg.GenerateStoryboard(filename, durationMs, 10)
+	if err != nil {
+		return err
+	}
+	var url string
+	if _, err := s.rpc.Call(context.Background(), "cast.storyboard", image, &url); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.Filename != filename {
+		s.mu.Unlock()
+		return nil
+	}
+	s.State.Storyboard = &Storyboard{URL: url, Storyboard: sb}
+	s.mu.Unlock()
+	return s.sendState()
+}
+
 func (s *Session) handleProgress() {
 	lastRun := 0
 	for update := range s.FFmpeg.Updates {
@@ -155,18 +294,23 @@ func (s *Session) handleProgress() {
 			continue
 		}
 		lastRun = update.Run
-		if update.Progress["out_time"] == "N/A" {
+		health := s.health.update(update.Run, update.Progress)
+		if update.Progress.OutTimeMs < 0 {
 			continue
 		}
-		timeMs, err := ffmpeg.ParseTimeToMs(update.Progress["out_time"])
-		if err != nil {
-			log.Fatal("parse time:", err)
-		}
-		posMs := update.SeekMs + timeMs
+		posMs := update.SeekMs + update.Progress.OutTimeMs
 		s.mu.Lock()
+		if update.Run == s.seekRun && !s.seekAt.IsZero() {
+			s.seekLatency.Observe(time.Since(s.seekAt).Seconds())
+			s.seekAt = time.Time{}
+		}
+		if health != nil && !health.OK && (s.State.Health == nil || s.State.Health.OK) {
+			s.log.Warn("stream health", "problems", strings.Join(health.Problems, ", "), "speed", health.Speed)
+		}
 		s.State.Status = StatusPlaying
 		s.State.Position = ffmpeg.FormatTimeMs(posMs)
 		s.State.PositionMs = posMs
+		s.State.Health = health
 		s.mu.Unlock()
 		s.sendState()
 	}
@@ -175,6 +319,10 @@ func (s *Session) handleProgress() {
 func (s *Session) setStatus(status Status) error {
 	s.mu.Lock()
 	s.State.Status = status
+	if status != StatusPlaying {
+		// health only describes a running stream
+		s.State.Health = nil
+	}
 	s.mu.Unlock()
 	return s.sendState()
 }
@@ -192,17 +340,32 @@ func (s *Session) sendState() error {
 }
 
 func (s *Session) setupIngress(room string) error {
+	if s.Protocol == ProtocolWebRTC {
+		return s.setupWebRTC(room)
+	}
+
 	var ingressPath string
-	_, err := s.rpc.Call(context.Background(), "cast.ingress", room, &ingressPath)
+	_, err := s.rpc.Call(context.Background(), "cast.ingress", s.Protocol, &ingressPath)
 	if err != nil {
 		return err
 	}
 
+	if s.Protocol == ProtocolWHIP {
+		s.mu.Lock()
+		s.LocalIngress = s.ServerURL
+		s.LocalIngress.Scheme = strings.Replace(s.ServerURL.Scheme, "ws", "http", 1)
+		s.LocalIngress.Path = ingressPath
+		s.mu.Unlock()
+		s.log.Info("publishing via whip", "ingress", s.LocalIngress.String())
+		return nil
+	}
+
 	l, err := net.Listen("tcp4", ":0")
 	if err != nil {
 		return err
 	}
 	s.mu.Lock()
+	s.ingress = l
 	s.LocalIngress.Scheme = "rtmp"
 	s.LocalIngress.Host = l.Addr().String()
 	s.LocalIngress.Path = ingressPath
@@ -210,49 +373,68 @@ func (s *Session) setupIngress(room string) error {
 	ingressURL.Path = "/-/cast/ingress"
 	s.mu.Unlock()
 
-	log.Println("ingress:", s.LocalIngress.String())
+	s.log.Info("publishing via rtmp tunnel", "ingress", s.LocalIngress.String())
 
-	go func() {
-		var (
-			ws *websocket.Conn
-		)
-		for {
-			conn, err := l.Accept()
-			if err != nil {
-				log.Fatal("ingress:", err)
-			}
-			if ws != nil {
-				ws.Close()
-			}
-			ws, err = websocket.Dial(ingressURL.String()+"?room="+room, "", s.ServerURL.String())
+	go s.tunnelIngress(l, ingressURL, room)
+
+	return nil
+}
+
+// tunnelIngress tunnels each ffmpeg connection to the server. A failure ends
+// only that run, and the next run dials the server again.
+func (s *Session) tunnelIngress(l net.Listener, ingressURL url.URL, room string) {
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.log.Error("ingress accept", "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		ws, err := s.dialIngress(ingressURL, room)
+		if err != nil {
+			s.log.Error("ingress dial", "err", err)
+			conn.Close()
+			continue
+		}
+		s.mu.Lock()
+		if s.Filename == "" && s.State.Status == StatusPlaying {
+			s.State.Status = StatusLive
+			s.State.Position = ffmpeg.FormatTimeMs(0)
+			s.State.PositionMs = 0
+		}
+		s.mu.Unlock()
+		s.sendState()
+
+		go func() {
+			t := &server.Tunnel{WriteTimeout: 10 * time.Second}
+			err := t.Run(ws, conn)
 			if err != nil {
-				log.Fatal("ingress:", err)
-			}
-			s.mu.Lock()
-			if s.Filename == "" && s.State.Status == StatusPlaying {
-				s.State.Status = StatusLive
-				s.State.Position = ffmpeg.FormatTimeMs(0)
-				s.State.PositionMs = 0
+				s.log.Error("ingress tunnel", "err", err, "sent", t.Sent.Load())
+				return
 			}
-			s.mu.Unlock()
-			s.sendState()
+			s.log.Debug("ingress tunnel closed", "sent", t.Sent.Load())
+		}()
+	}
+}
 
-			go func() {
-				_, err := io.Copy(ws, conn)
-				if err != nil {
-					log.Println("ingress:", err)
-				}
-			}()
-			go func() {
-				_, err := io.Copy(conn, ws)
-				if err != nil {
-					log.Println("ingress:", err)
-				}
-			}()
+// dialIngress dials the server's ingress tunnel, retrying with backoff.
+func (s *Session) dialIngress(ingressURL url.URL, room string) (*websocket.Conn, error) {
+	var err error
+	wait := 500 * time.Millisecond
+	for attempt := 0; attempt < 5; attempt++ {
+		var ws *websocket.Conn
+		ws, err = websocket.Dial(ingressURL.String()+"?room="+room, "", s.ServerURL.String())
+		if err == nil {
+			return ws, nil
 		}
-	}()
-
-	return nil
+		s.log.Warn("ingress dial, retrying", "wait", wait, "err", err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+	return nil, err
 }
 
 func (s *Session) setupChat() error {
@@ -271,17 +453,25 @@ func (s *Session) setupChat() error {
 				if err == io.EOF {
 					return
 				}
-				log.Fatal("chat:", err)
+				s.log.Error("chat", "err", err)
+				return
 			}
-			log.Println("CHAT:", msg)
+			message, _ := msg["message"].(string)
+			participant, _ := msg["participant"].(string)
+			name, _ := msg["participantName"].(string)
+			s.log.Debug("chat", "participant", participant, "message", message)
 
-			args := strings.Split(msg["message"].(string), " ")
-			c := cmds(s)[args[0]]
-			if c == nil {
+			args := strings.Split(message, " ")
+			if cmds(s)[args[0]] == nil {
 				continue
 			}
-			if err := c(args[1:]); err != nil {
-				log.Println("cmd:", err)
+			if err := s.runCommand(participant, args); err != nil {
+				s.log.Error("command", "command", args[0], "participant", participant, "err", err)
+				continue
+			}
+			accepted := ChatCommand{Identity: participant, Name: name, Command: message}
+			if _, err := s.rpc.Call(context.Background(), "cast.command", accepted); err != nil {
+				s.log.Warn("report command", "err", err)
 			}
 		}
 	}()
@@ -289,14 +479,217 @@ func (s *Session) setupChat() error {
 	return nil
 }
 
-func (s *Session) play(startMs int) error {
-	if err := s.FFmpeg.Start(s.Filename, startMs, s.LocalIngress.String()); err != nil {
+func osdFont() (string, error) {
+	font := filepath.Join(os.TempDir(), "tapecafe-vcrosdmono.ttf")
+	return font, os.WriteFile(font, ui.OSDFont, 0644)
+}
+
+// EnableOSD burns the VCR-style status overlay into the cast video.
+func (s *Session) EnableOSD() error {
+	font, err := osdFont()
+	if err != nil {
+		return err
+	}
+	s.FFmpeg.Lock()
+	s.FFmpeg.Options.OSD = &ffmpeg.OSD{
+		Font:    font,
+		Seconds: 4,
+	}
+	s.FFmpeg.Unlock()
+	return nil
+}
+
+// EnableSlate streams a title card while no content is playing, over image
+// if it is set to a still image or video file.
+func (s *Session) EnableSlate(image string) error {
+	font, err := osdFont()
+	if err != nil {
+		return err
+	}
+	s.FFmpeg.Lock()
+	s.FFmpeg.Options.Slate = &ffmpeg.Slate{
+		Font:  font,
+		Image: image,
+	}
+	s.FFmpeg.Unlock()
+	return nil
+}
+
+// showSlate streams the slate for status in place of any content, or just
+// stops ffmpeg if the slate isn't enabled.
+func (s *Session) showSlate(status Status, detail string) error {
+	s.FFmpeg.Lock()
+	enabled := s.FFmpeg.Options.Slate != nil
+	s.FFmpeg.Unlock()
+	if !enabled {
+		return s.FFmpeg.Stop()
+	}
+	s.mu.Lock()
+	text := strings.TrimSpace(string(status) + " " + detail)
+	if s.State.Title != "" && status != StatusDownload {
+		text += "\n\n" + s.State.Title
+	}
+	s.mu.Unlock()
+	return s.FFmpeg.StartSlate(text, s.LocalIngress.String())
+}
+
+// stream (re)starts ffmpeg at posMs, labeling the OSD with osdStatus if
+// enabled, and publishes the position the seek actually landed on.
+func (s *Session) stream(posMs int, osdStatus string) error {
+	s.mu.Lock()
+	title := s.State.Title
+	s.mu.Unlock()
+	s.FFmpeg.Lock()
+	if osd := s.FFmpeg.Options.OSD; osd != nil {
+		osd.Status = osdStatus
+		osd.Title = title
+	}
+	s.FFmpeg.Unlock()
+	startedAt := time.Now()
+	landedMs, err := s.FFmpeg.Start(s.Filename, posMs, s.LocalIngress.String())
+	if err != nil {
 		s.setStatus(StatusError)
 		return err
 	}
+	s.FFmpeg.Lock()
+	run := s.FFmpeg.Run
+	s.FFmpeg.Unlock()
+	s.mu.Lock()
+	s.seekRun, s.seekAt = run, startedAt
+	s.State.PositionMs = landedMs
+	s.State.Position = ffmpeg.FormatTimeMs(landedMs)
+	s.mu.Unlock()
+	return nil
+}
+
+// ChatCommand is a command from chat the caster ran, reported back to the
+// server for the room's event log.
+type ChatCommand struct {
+	Identity string
+	Name     string
+	Command  string
+}
+
+// runCommand runs a slash command like ["/seek", "01:00"] issued by
+// participant.
+func (s *Session) runCommand(participant string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command")
+	}
+	c := cmds(s)[args[0]]
+	if c == nil {
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	s.log.Info("command", "command", args[0], "args", args[1:], "participant", participant)
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+	return c(args[1:])
+}
+
+// unlocked runs fn with the command lock released, for a command to wait on
+// something slow without holding up the commands after it.
+func (s *Session) unlocked(fn func()) {
+	s.cmdMu.Unlock()
+	defer s.cmdMu.Lock()
+	fn()
+}
+
+// downloading reports whether a download is still what the session shows,
+// rather than another command having taken over.
+func (s *Session) downloading() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.State.Status == StatusDownload
+}
+
+// runTimed runs fn for a timer firing, serialized with commands, unless ctx
+// was canceled by a command meanwhile.
+func (s *Session) runTimed(ctx context.Context, fn func() error) error {
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fn()
+}
+
+func (s *Session) play(startMs int) error {
+	s.unschedule()
+	s.stopCountdown()
+	if err := s.stream(startMs, string(StatusStarting)); err != nil {
+		return err
+	}
 	return s.setStatus(StatusStarting)
 }
 
+// countdown streams a countdown leader of seconds, publishing the remaining
+// time, then plays from startMs unless another transport command stopped it
+// meanwhile.
+func (s *Session) countdown(seconds, startMs int) error {
+	font, err := osdFont()
+	if err != nil {
+		return err
+	}
+	s.stopCountdown()
+	if err := s.FFmpeg.StartCountdown(seconds, font, s.LocalIngress.String()); err != nil {
+		s.setStatus(StatusError)
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancelCount = cancel
+	s.mu.Unlock()
+	go func() {
+		for n := seconds; n > 0; n-- {
+			// stopCountdown cancels under mu, so a tick can't overwrite the
+			// status of the command that stopped the countdown
+			s.mu.Lock()
+			if ctx.Err() != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.State.Status = countdownStatus(n)
+			s.State.Health = nil
+			s.mu.Unlock()
+			s.sendState()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+		err := s.runTimed(ctx, func() error {
+			s.mu.Lock()
+			if ctx.Err() != nil {
+				s.mu.Unlock()
+				return nil
+			}
+			s.cancelCount = nil
+			s.countScheduled = false
+			s.mu.Unlock()
+			return s.play(startMs)
+		})
+		if err != nil {
+			s.log.Error("countdown", "err", err)
+		}
+	}()
+	return nil
+}
+
+// stopCountdown cancels a countdown in progress, reporting whether there
+// was one.
+func (s *Session) stopCountdown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelCount == nil {
+		return false
+	}
+	s.cancelCount()
+	s.cancelCount = nil
+	s.countScheduled = false
+	return true
+}
+
 func (s *Session) seek(posMs int) error {
 	s.mu.Lock()
 	oldPosMs := s.State.PositionMs
@@ -304,26 +697,53 @@ func (s *Session) seek(posMs int) error {
 	s.State.Position = ffmpeg.FormatTimeMs(posMs)
 	status := s.State.Status
 	s.mu.Unlock()
-	if status == StatusPlaying {
-		if err := s.FFmpeg.Start(s.Filename, posMs, s.LocalIngress.String()); err != nil {
-			s.setStatus(StatusError)
+	// seeking during a countdown leaves the tape ready at the new position
+	if s.stopCountdown() {
+		if err := s.showSlate(StatusReady, ""); err != nil {
 			return err
 		}
+		return s.setStatus(StatusReady)
+	}
+	if status == StatusPlaying {
 		offsetMs := posMs - oldPosMs
+		s.log.Debug("seek", "from", ffmpeg.FormatTimeMs(oldPosMs), "to", ffmpeg.FormatTimeMs(posMs))
+		status = StatusSeeking
 		if offsetMs > 0 {
-			log.Println("seeking forward", offsetMs)
-			return s.setStatus(StatusFwd)
+			status = StatusFwd
 		} else if offsetMs < 0 {
-			log.Println("seeking forward", offsetMs)
-			return s.setStatus(StatusBack)
+			status = StatusBack
+		}
+		if err := s.stream(posMs, string(status)); err != nil {
+			return err
 		}
-		return s.setStatus(StatusSeeking)
+		return s.setStatus(status)
 	}
-	return nil
+	return s.sendState()
+}
+
+func (s *Session) setVolume(db float64) error {
+	s.FFmpeg.Lock()
+	s.FFmpeg.Options.GainDb = db
+	s.FFmpeg.Unlock()
+
+	s.mu.Lock()
+	s.State.VolumeDb = db
+	s.State.Volume = ffmpeg.FormatGainDb(db)
+	posMs := s.State.PositionMs
+	status := s.State.Status
+	s.mu.Unlock()
+	if status == StatusPlaying {
+		if err := s.stream(posMs, "VOL "+ffmpeg.FormatGainDb(db)); err != nil {
+			return err
+		}
+	}
+	return s.sendState()
 }
 
 func (s *Session) pause() error {
-	if err := s.FFmpeg.Stop(); err != nil {
+	s.unschedule()
+	s.stopCountdown()
+	if err := s.showSlate(StatusPaused, ""); err != nil {
 		s.setStatus(StatusError)
 		return err
 	}
@@ -331,15 +751,17 @@ func (s *Session) pause() error {
 }
 
 func (s *Session) stop() error {
-	if err := s.FFmpeg.Stop(); err != nil {
-		s.setStatus(StatusError)
-		return err
-	}
+	s.unschedule()
+	s.stopCountdown()
 	s.mu.Lock()
 	s.Filename = ""
 	s.State.Title = ""
 	s.State.Position = ffmpeg.FormatTimeMs(0)
 	s.State.PositionMs = 0
 	s.mu.Unlock()
+	if err := s.showSlate(StatusFinished, ""); err != nil {
+		s.setStatus(StatusError)
+		return err
+	}
 	return s.setStatus(StatusFinished)
 }
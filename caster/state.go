@@ -1,27 +1,51 @@
 package caster
 
+import (
+	"fmt"
+
+	"github.com/progrium/tapecafe/ffmpeg"
+)
+
 type SharedState struct {
 	Title      string
 	Length     string
 	LengthMs   int
 	Position   string
 	PositionMs int
+	Volume     string
+	VolumeDb   float64
+	StartsAt   string
+	Storyboard *Storyboard
 	Status     Status
+	// Health is how well the caster keeps up while streaming, if it is.
+	Health *Health
+}
+
+// Storyboard is a thumbnail sprite sheet of the tape served at URL.
+type Storyboard struct {
+	URL string
+	ffmpeg.Storyboard
 }
 
 type Status string
 
 const (
-	StatusPlaying  Status = ""
-	StatusInit     Status = "█ NO TAPE"
-	StatusStarting Status = "⏵ PLAY"
-	StatusPaused   Status = "▊ PAUSE"
-	StatusReady    Status = "⏯ TAPE READY"
-	StatusSeeking  Status = "⏩ SEEK"
-	StatusFwd      Status = "⏭ FWD"
-	StatusBack     Status = "⏮ BACK"
-	StatusFinished Status = "⏏ EJECT"
-	StatusLive     Status = "⏺ LIVE FEED"
-	StatusDownload Status = "⏬ DOWNLOADING"
-	StatusError    Status = "! ERROR"
+	StatusPlaying   Status = ""
+	StatusInit      Status = "█ NO TAPE"
+	StatusStarting  Status = "⏵ PLAY"
+	StatusPaused    Status = "▊ PAUSE"
+	StatusReady     Status = "⏯ TAPE READY"
+	StatusSeeking   Status = "⏩ SEEK"
+	StatusFwd       Status = "⏭ FWD"
+	StatusBack      Status = "⏮ BACK"
+	StatusFinished  Status = "⏏ EJECT"
+	StatusLive      Status = "⏺ LIVE FEED"
+	StatusDownload  Status = "⏬ DOWNLOADING"
+	StatusError     Status = "! ERROR"
+	StatusCountdown Status = "⏳ STARTING IN"
+	StatusScheduled Status = "⏲ STARTS IN"
 )
+
+func countdownStatus(seconds int) Status {
+	return Status(fmt.Sprintf("%s %d", StatusCountdown, seconds))
+}
@@ -0,0 +1,248 @@
+package caster
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/url"
+	"time"
+
+	lkp "github.com/livekit/protocol/livekit"
+	lksdk2 "github.com/livekit/server-sdk-go/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+	"github.com/pion/webrtc/v3/pkg/media/oggreader"
+	"github.com/progrium/tapecafe/ffmpeg"
+)
+
+const (
+	videoFrameDuration = time.Second / 30
+	audioPageDuration  = 20 * time.Millisecond
+)
+
+// setupWebRTC joins the room as the caster and publishes a video and audio
+// track fed by local listeners that ffmpeg connects to on every run, so the
+// tracks stay published across seeks, slates and pauses.
+func (s *Session) setupWebRTC(room string) error {
+	var token string
+	if _, err := s.rpc.Call(context.Background(), "cast.token", nil, &token); err != nil {
+		return err
+	}
+
+	video, err := newTrackSource(readH264)
+	if err != nil {
+		return err
+	}
+	audio, err := newTrackSource(readOgg)
+	if err != nil {
+		video.Close()
+		return err
+	}
+
+	rtcURL := s.ServerURL
+	rtcURL.Path = ""
+	lkRoom, err := lksdk2.ConnectToRoomWithToken(rtcURL.String(), token, &lksdk2.RoomCallback{}, lksdk2.WithAutoSubscribe(false))
+	if err != nil {
+		video.Close()
+		audio.Close()
+		return err
+	}
+
+	if err := publishTrack(lkRoom, video, webrtc.MimeTypeH264, "video", lkp.TrackSource_CAMERA, s.log); err != nil {
+		lkRoom.Disconnect()
+		return err
+	}
+	if err := publishTrack(lkRoom, audio, webrtc.MimeTypeOpus, "audio", lkp.TrackSource_MICROPHONE, s.log); err != nil {
+		lkRoom.Disconnect()
+		return err
+	}
+
+	output, err := url.Parse(ffmpeg.TrackOutput(video.Addr(), audio.Addr()))
+	if err != nil {
+		lkRoom.Disconnect()
+		return err
+	}
+	s.mu.Lock()
+	s.LocalIngress = *output
+	s.lkRoom = lkRoom
+	s.tracks = []*trackSource{video, audio}
+	s.mu.Unlock()
+	s.log.Info("publishing via webrtc", "output", s.LocalIngress.String())
+	return nil
+}
+
+func publishTrack(room *lksdk2.Room, source *trackSource, mimeType, name string, kind lkp.TrackSource, logger *slog.Logger) error {
+	track, err := lksdk2.NewLocalTrack(webrtc.RTPCodecCapability{MimeType: mimeType})
+	if err != nil {
+		return err
+	}
+	track.OnBind(func() {
+		if err := track.StartWrite(source, nil); err != nil {
+			logger.Error("track write", "track", name, "err", err)
+		}
+	})
+	_, err = room.LocalParticipant.PublishTrack(track, &lksdk2.TrackPublicationOptions{
+		Name:   name,
+		Source: kind,
+	})
+	return err
+}
+
+// trackSource is a sample provider reading from whichever ffmpeg connection
+// is newest. Between runs it blocks until the next connection arrives.
+type trackSource struct {
+	lksdk2.BaseSampleProvider
+	listener net.Listener
+	conns    chan net.Conn
+	read     func(conn net.Conn) (func() (media.Sample, error), error)
+
+	conn net.Conn
+	next func() (media.Sample, error)
+}
+
+func newTrackSource(read func(conn net.Conn) (func() (media.Sample, error), error)) (*trackSource, error) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	t := &trackSource{
+		listener: l,
+		conns:    make(chan net.Conn, 1),
+		read:     read,
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// only the newest run matters, drop one still waiting
+			select {
+			case old := <-t.conns:
+				old.Close()
+			default:
+			}
+			t.conns <- conn
+		}
+	}()
+	return t, nil
+}
+
+func (t *trackSource) Addr() string {
+	return t.listener.Addr().String()
+}
+
+func (t *trackSource) use(conn net.Conn) {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	t.conn, t.next = conn, nil
+	next, err := t.read(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	t.next = next
+}
+
+func (t *trackSource) NextSample(ctx context.Context) (media.Sample, error) {
+	for {
+		select {
+		case conn := <-t.conns:
+			t.use(conn)
+		default:
+		}
+		if t.next == nil {
+			select {
+			case conn := <-t.conns:
+				t.use(conn)
+				continue
+			case <-ctx.Done():
+				return media.Sample{}, ctx.Err()
+			}
+		}
+		sample, err := t.next()
+		if err != nil {
+			t.next = nil
+			continue
+		}
+		if sample.Data == nil {
+			continue
+		}
+		return sample, nil
+	}
+}
+
+func (t *trackSource) Close() error {
+	if t.conn != nil {
+		t.conn.Close()
+	}
+	return t.listener.Close()
+}
+
+// readH264 groups the NAL units of the stream into access units, so a frame
+// encoded as several slices is sent as one sample lasting one frame.
+func readH264(conn net.Conn) (func() (media.Sample, error), error) {
+	r, err := h264reader.NewReader(conn)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		pending  []byte
+		hasSlice bool
+	)
+	return func() (media.Sample, error) {
+		for {
+			nal, err := r.NextNAL()
+			if err != nil {
+				return media.Sample{}, err
+			}
+			isSlice := nal.UnitType == h264reader.NalUnitTypeCodedSliceIdr ||
+				nal.UnitType == h264reader.NalUnitTypeCodedSliceNonIdr
+			startsUnit := false
+			switch {
+			case isSlice:
+				// a slice with first_mb_in_slice 0 starts a new picture
+				startsUnit = hasSlice && len(nal.Data) > 1 && nal.Data[1]&0x80 != 0
+			case nal.UnitType == h264reader.NalUnitTypeAUD,
+				nal.UnitType == h264reader.NalUnitTypeSPS,
+				nal.UnitType == h264reader.NalUnitTypePPS,
+				nal.UnitType == h264reader.NalUnitTypeSEI:
+				startsUnit = hasSlice
+			}
+			var sample media.Sample
+			if startsUnit {
+				sample = media.Sample{Data: pending, Duration: videoFrameDuration}
+				pending, hasSlice = nil, false
+			}
+			pending = append(pending, annexBStartCode...)
+			pending = append(pending, nal.Data...)
+			hasSlice = hasSlice || isSlice
+			if sample.Data != nil {
+				return sample, nil
+			}
+		}
+	}, nil
+}
+
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+func readOgg(conn net.Conn) (func() (media.Sample, error), error) {
+	r, _, err := oggreader.NewWith(conn)
+	if err != nil {
+		return nil, err
+	}
+	return func() (media.Sample, error) {
+		data, _, err := r.ParseNextPage()
+		if err != nil {
+			return media.Sample{}, err
+		}
+		// skip the comment header page of each new stream
+		if bytes.HasPrefix(data, []byte("OpusTags")) {
+			return media.Sample{}, nil
+		}
+		return media.Sample{Data: data, Duration: audioPageDuration}, nil
+	}, nil
+}
@@ -0,0 +1,52 @@
+package caster
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestReadH264GroupsSlices(t *testing.T) {
+	nal := func(header byte, firstMB bool) []byte {
+		b := byte(0x00)
+		if firstMB {
+			b = 0x80
+		}
+		return append([]byte{0, 0, 0, 1, header, b}, 0xaa, 0xbb)
+	}
+	var stream bytes.Buffer
+	for _, n := range [][]byte{
+		nal(0x67, true),  // SPS
+		nal(0x68, true),  // PPS
+		nal(0x65, true),  // IDR, first slice
+		nal(0x65, false), // IDR, second slice
+		nal(0x41, true),  // non-IDR, first slice
+		nal(0x41, false),
+		nal(0x41, false),
+		nal(0x41, true), // next frame, only read to end the previous one
+	} {
+		stream.Write(n)
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		server.Write(stream.Bytes())
+		server.Close()
+	}()
+	next, err := readH264(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, wantNALs := range []int{4, 3} {
+		sample, err := next()
+		if err != nil {
+			t.Fatalf("sample %d: %v", i, err)
+		}
+		if got := bytes.Count(sample.Data, annexBStartCode); got != wantNALs {
+			t.Errorf("sample %d has %d NALs, want %d", i, got, wantNALs)
+		}
+		if sample.Duration != videoFrameDuration {
+			t.Errorf("sample %d lasts %v, want %v", i, sample.Duration, videoFrameDuration)
+		}
+	}
+}
@@ -3,17 +3,20 @@ package caster
 import (
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kkdai/youtube/v2"
 	"github.com/progrium/tapecafe/ffmpeg"
 )
 
-func DownloadYoutubeVideo(url string) (string, error) {
+// DownloadYoutubeVideo downloads and merges the best video and audio streams,
+// calling progress (if not nil) as the download percentage changes.
+func DownloadYoutubeVideo(url string, progress func(percent int)) (string, error) {
 	videoID, ok := detectYouTubeURL(url)
 	if !ok {
 		return "", fmt.Errorf("invalid YouTube URL: %s", url)
@@ -32,20 +35,22 @@ func DownloadYoutubeVideo(url string) (string, error) {
 			idx = i
 		}
 	}
-	log.Println("downloading youtube:", videoID, vformats[idx].Quality)
-	vstream, _, err := client.GetStream(video, &vformats[idx])
+	slog.Info("downloading youtube", "video", videoID, "quality", vformats[idx].Quality)
+	vstream, vsize, err := client.GetStream(video, &vformats[idx])
 	if err != nil {
 		return "", err
 	}
 	defer vstream.Close()
 
 	aformats := video.Formats.Type("audio")
-	astream, _, err := client.GetStream(video, &aformats[0])
+	astream, asize, err := client.GetStream(video, &aformats[0])
 	if err != nil {
 		return "", err
 	}
 	defer astream.Close()
 
+	pw := &progressWriter{total: vsize + asize, fn: progress}
+
 	tempDir := os.TempDir()
 
 	videoFilename := filepath.Join(tempDir, videoID+".video.mp4")
@@ -62,23 +67,28 @@ func DownloadYoutubeVideo(url string) (string, error) {
 	}
 	defer afile.Close()
 
-	var wg sync.WaitGroup
+	started := time.Now()
+	var (
+		wg         sync.WaitGroup
+		verr, aerr error
+	)
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		_, err = io.Copy(vfile, vstream)
-		if err != nil {
-			log.Println(err)
-		}
+		_, verr = io.Copy(vfile, io.TeeReader(vstream, pw))
 	}()
 	go func() {
 		defer wg.Done()
-		_, err = io.Copy(afile, astream)
-		if err != nil {
-			log.Println(err)
-		}
+		_, aerr = io.Copy(afile, io.TeeReader(astream, pw))
 	}()
 	wg.Wait()
+	downloadSeconds.Add(time.Since(started).Seconds())
+	if verr != nil {
+		return "", fmt.Errorf("download video: %w", verr)
+	}
+	if aerr != nil {
+		return "", fmt.Errorf("download audio: %w", aerr)
+	}
 
 	outputFilename := filepath.Join(tempDir, videoID+".mp4")
 	if err := ffmpeg.MergeAV(videoFilename, audioFilename, outputFilename, video.Title); err != nil {
@@ -87,6 +97,31 @@ func DownloadYoutubeVideo(url string) (string, error) {
 	return outputFilename, nil
 }
 
+type progressWriter struct {
+	total int64
+	done  int64
+	last  int
+	fn    func(percent int)
+	mu    sync.Mutex
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	downloadBytes.Add(float64(len(b)))
+	if p.fn == nil || p.total <= 0 {
+		return len(b), nil
+	}
+	p.mu.Lock()
+	p.done += int64(len(b))
+	percent := int(p.done * 100 / p.total)
+	changed := percent != p.last
+	p.last = percent
+	p.mu.Unlock()
+	if changed {
+		p.fn(percent)
+	}
+	return len(b), nil
+}
+
 func detectYouTubeURL(s string) (string, bool) {
 	if !strings.HasPrefix(s, "https://www.youtube.com/") &&
 		!strings.HasPrefix(s, "https://youtu.be/") &&
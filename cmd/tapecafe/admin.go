@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	lkp "github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go"
+	"github.com/progrium/tapecafe/caster"
+)
+
+type adminRoom struct {
+	Name             string
+	Caster           *casterConn
+	State            *caster.SharedState
+	Ingress          *lkp.IngressInfo
+	StateSubscribers int
+	Participants     []*lkp.ParticipantInfo
+}
+
+func roomClient() *lksdk.RoomServiceClient {
+	return lksdk.NewRoomServiceClient(lkAPIURL, lkAPIKey, lkAPISecret)
+}
+
+// adminRooms collects every room known to the server or to LiveKit. The
+// rooms known to the server are returned along with an error when LiveKit
+// can't be reached.
+func adminRooms(ctx context.Context) ([]*adminRoom, error) {
+	rooms := map[string]*adminRoom{}
+	get := func(name string) *adminRoom {
+		if _, ok := rooms[name]; !ok {
+			rooms[name] = &adminRoom{Name: name}
+		}
+		return rooms[name]
+	}
+
+	casters.Range(func(key, value any) bool {
+		get(key.(string)).Caster = value.(*casterConn)
+		return true
+	})
+	lastStates.Range(func(key, value any) bool {
+		state := value.(caster.SharedState)
+		get(key.(string)).State = &state
+		return true
+	})
+	ingresses.Range(func(key, value any) bool {
+		get(key.(string)).Ingress = value.(*lkp.IngressInfo)
+		return true
+	})
+	stateListenersMu.Lock()
+	for name, listeners := range stateListeners {
+		n := 0
+		listeners.Range(func(key, value any) bool {
+			n++
+			return true
+		})
+		get(name).StateSubscribers = n
+	}
+	stateListenersMu.Unlock()
+
+	client := roomClient()
+	resp, err := client.ListRooms(ctx, &lkp.ListRoomsRequest{})
+	if err != nil {
+		err = fmt.Errorf("list rooms: %w", err)
+	} else {
+		for _, r := range resp.GetRooms() {
+			get(r.GetName())
+		}
+		for name, room := range rooms {
+			resp, err := client.ListParticipants(ctx, &lkp.ListParticipantsRequest{Room: name})
+			if err != nil {
+				continue
+			}
+			room.Participants = resp.GetParticipants()
+		}
+	}
+
+	var list []*adminRoom
+	for _, room := range rooms {
+		list = append(list, room)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, err
+}
+
+// handleAdminRooms serves GET /-/api/admin/rooms, reporting in LiveKitError
+// when only the rooms known to the server could be listed.
+func handleAdminRooms(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	var resp struct {
+		Rooms        []*adminRoom
+		LiveKitError string `json:",omitempty"`
+	}
+	rooms, err := adminRooms(ctx)
+	resp.Rooms = rooms
+	if err != nil {
+		resp.LiveKitError = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleAdminRoomAction serves POST /-/api/admin/rooms/<room>/<action> for
+// the actions kick (with a JSON {"identity": ...} body), delete-ingress and
+// close, and GET /-/api/admin/rooms/<room>/transcript.
+func handleAdminRoomAction(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	room, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/-/api/admin/rooms/"), "/")
+	if !ok || room == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodGet && action == "transcript" {
+		handleTranscript(w, r, room)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	switch action {
+	case "kick":
+		var body struct {
+			Identity string `json:"identity"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Identity == "" {
+			http.Error(w, "identity required", http.StatusBadRequest)
+			return
+		}
+		_, err = roomClient().RemoveParticipant(ctx, &lkp.RoomParticipantIdentity{
+			Room:     room,
+			Identity: body.Identity,
+		})
+	case "delete-ingress":
+		err = deleteIngress(ctx, room)
+	case "close":
+		if cc, ok := casters.Load(room); ok {
+			cc.(*casterConn).Close()
+		}
+		if err = deleteIngress(ctx, room); err == nil {
+			_, err = roomClient().DeleteRoom(ctx, &lkp.DeleteRoomRequest{Room: room})
+		}
+		lastStates.Delete(room)
+		storyboards.Delete(room)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleAdminPage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, adminPage)
+}
+
+const adminPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8" />
+<title>Tape Cafe Admin</title>
+<style>
+  body { font-family: monospace; background: #111; color: #eee; margin: 2em; }
+  table { border-collapse: collapse; margin-bottom: 2em; }
+  td, th { border: 1px solid #444; padding: 4px 8px; text-align: left; vertical-align: top; }
+  button { font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Tape Cafe Admin</h1>
+<div id="rooms">Loading...</div>
+<script>
+let token = localStorage.getItem("tapecafe-api-token") || ""
+
+async function api(method, path, body) {
+  if (!token) {
+    token = prompt("API token") || ""
+    localStorage.setItem("tapecafe-api-token", token)
+  }
+  const resp = await fetch(path, {
+    method,
+    headers: { "Authorization": "Bearer " + token, "Content-Type": "application/json" },
+    body: body && JSON.stringify(body),
+  })
+  if (resp.status === 401 || resp.status === 403) {
+    localStorage.removeItem("tapecafe-api-token")
+    token = ""
+  }
+  if (!resp.ok) throw new Error(await resp.text())
+  return resp.status === 204 ? null : resp.json()
+}
+
+async function action(room, name, body) {
+  if (name === "close" && !confirm("Close room " + room + "?")) return
+  try {
+    await api("POST", "/-/api/admin/rooms/" + encodeURIComponent(room) + "/" + name, body)
+  } catch (err) {
+    alert(err.message)
+  }
+  refresh()
+}
+
+function esc(s) {
+  const d = document.createElement("div")
+  d.textContent = s == null ? "" : String(s)
+  return d.innerHTML.replace(/"/g, "&quot;").replace(/'/g, "&#39;")
+}
+
+async function refresh() {
+  const el = document.getElementById("rooms")
+  let resp
+  try {
+    resp = await api("GET", "/-/api/admin/rooms")
+  } catch (err) {
+    el.textContent = err.message
+    return
+  }
+  const rooms = resp.Rooms || []
+  const warning = resp.LiveKitError ? "<p>LiveKit: " + esc(resp.LiveKitError) + "</p>" : ""
+  if (rooms.length === 0) {
+    el.innerHTML = warning + "No rooms."
+    return
+  }
+  el.innerHTML = warning + rooms.map(room => {
+    const r = JSON.stringify(room.Name)
+    const state = room.State || {}
+    const participants = (room.Participants || []).map(p =>
+      "<tr><td>" + esc(p.identity) + "</td><td>" + esc(p.name) + "</td>" +
+      "<td><button onclick='action(" + esc(r) + ", \"kick\", {identity: " + esc(JSON.stringify(p.identity)) + "})'>kick</button></td></tr>"
+    ).join("")
+    return "<h2>" + esc(room.Name) + "</h2><table>" +
+      "<tr><th>Caster</th><td>" + (room.Caster ? esc(room.Caster.RemoteAddr + " since " + room.Caster.ConnectedAt) : "none") + "</td></tr>" +
+      "<tr><th>State</th><td>" + esc([state.Status, state.Title, state.Position, state.Length].filter(Boolean).join(" | ")) + "</td></tr>" +
+      "<tr><th>Health</th><td>" + (state.Health ? esc((state.Health.OK ? "ok" : state.Health.Problems.join(", ")) +
+        " | " + state.Health.Speed.toFixed(2) + "x " + Math.round(state.Health.BitrateKbps) + " kbit/s " +
+        state.Health.DropFrames + " dropped") : "-") + "</td></tr>" +
+      "<tr><th>Ingress</th><td>" + (room.Ingress ? esc(room.Ingress.ingress_id + " " + room.Ingress.url) +
+        " <button onclick='action(" + esc(r) + ", \"delete-ingress\")'>delete</button>" : "none") + "</td></tr>" +
+      "<tr><th>State subscribers</th><td>" + room.StateSubscribers + "</td></tr>" +
+      "<tr><th>Participants</th><td><table>" + participants + "</table></td></tr>" +
+      "</table><button onclick='action(" + esc(r) + ", \"close\")'>close room</button>"
+  }).join("")
+}
+
+refresh()
+setInterval(refresh, 5000)
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/progrium/tapecafe/caster"
+	"tractor.dev/toolkit-go/duplex/rpc"
+	"tractor.dev/toolkit-go/duplex/talk"
+)
+
+var (
+	apiToken string
+
+	// casters holds the *casterConn of the caster connected to each room
+	casters sync.Map
+
+	apiCommand = regexp.MustCompile(`^[a-z]+$`)
+)
+
+// casterConn is a caster's RPC connection, shown in the admin API.
+type casterConn struct {
+	*talk.Peer  `json:"-"`
+	RemoteAddr  string
+	ConnectedAt time.Time
+
+	chat chan string
+}
+
+// say posts msg to the room's chat as the chat bot, waiting until ctx is
+// done for the bot to take it.
+func (cc *casterConn) say(ctx context.Context, msg string) error {
+	select {
+	case cc.chat <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// authorized checks the request's bearer token against the API token. The
+// API is disabled when no token is configured.
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if apiToken == "" {
+		http.Error(w, "api disabled, no api token set", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// handleRoomAPI forwards POST /-/api/rooms/<room>/<command> to the room's
+// caster as /<command> with the "args" of the JSON body, if any, and
+// responds with the resulting shared state.
+func handleRoomAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorized(w, r) {
+		return
+	}
+	room, command, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/-/api/rooms/"), "/")
+	if !ok || room == "" || !apiCommand.MatchString(command) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var body struct {
+		Args []string `json:"args"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	cc, ok := casters.Load(room)
+	if !ok {
+		http.Error(w, "no caster connected to room", http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	var state caster.SharedState
+	args := append([]string{"/" + command}, body.Args...)
+	countCommand(args[0], "api")
+	if _, err := cc.(*casterConn).Call(ctx, "caster.cmd", args, &state); err != nil {
+		// the caster rejected the command, or it couldn't be reached
+		code := http.StatusBadGateway
+		var remote rpc.RemoteError
+		if errors.As(err, &remote) {
+			code = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	roomEventLog(room).record(roomEvent{
+		Type:     eventCommand,
+		Identity: "api",
+		Command:  strings.Join(args, " "),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
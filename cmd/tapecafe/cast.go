@@ -1,24 +1,45 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/progrium/tapecafe/caster"
+	"github.com/progrium/tapecafe/ffmpeg"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"tractor.dev/toolkit-go/engine/cli"
 )
 
 func castCmd() *cli.Command {
 	var (
-		title string
+		title      string
+		normalize  string
+		osd        bool
+		slate      bool
+		slateImage string
+		countdown  int
+		at         string
+		resume     bool
+		fastSeek   bool
+		protocol   string
+		metrics    string
 	)
 	cmd := &cli.Command{
 		Usage: "cast <server-url> <room> [filename]",
 		// Short: "",
 		Args: cli.MinArgs(2),
 		Run: func(ctx *cli.Context, args []string) {
+			if err := setupLogging(); err != nil {
+				fatal("cast", "err", err)
+			}
+
 			var (
 				serverURL = args[0]
 				room      = args[1]
@@ -28,24 +49,116 @@ func castCmd() *cli.Command {
 				filename = args[2]
 			}
 
+			var saved *caster.SavedState
+			if resume {
+				var err error
+				saved, err = caster.LoadState(room)
+				if err != nil {
+					fatal("cast", "err", err)
+				}
+				if saved == nil {
+					slog.Warn("no saved state to resume", "room", room)
+				} else if filename == "" {
+					filename = saved.Filename
+					if title == "" {
+						title = saved.Title
+					}
+				} else if abs, _ := filepath.Abs(filename); abs != saved.Filename {
+					slog.Warn("not resuming, saved state is for another file", "room", room, "file", saved.Filename)
+					saved = nil
+				}
+			}
+
+			switch protocol {
+			case caster.ProtocolRTMP, caster.ProtocolWHIP, caster.ProtocolWebRTC:
+			default:
+				fatal("cast: unknown protocol", "protocol", protocol)
+			}
+			if _, ok := ffmpeg.NormalizeFilters[normalize]; normalize != "" && !ok {
+				fatal("cast: unknown normalize filter", "normalize", normalize)
+			}
+
 			session, err := caster.New(serverURL, room, filename, title)
 			if err != nil {
-				log.Fatal("cast:", err)
+				fatal("cast", "err", err)
+			}
+			session.Protocol = protocol
+			session.FFmpeg.Options.Normalize = normalize
+			session.FFmpeg.Options.FastSeek = fastSeek
+			session.Countdown = countdown
+			if osd {
+				if err := session.EnableOSD(); err != nil {
+					fatal("cast", "err", err)
+				}
+			}
+			if slate || slateImage != "" {
+				if err := session.EnableSlate(slateImage); err != nil {
+					fatal("cast", "err", err)
+				}
 			}
 
 			if err := session.Start(); err != nil {
-				log.Fatal("cast:", err)
+				fatal("cast", "err", err)
+			}
+
+			if metrics != "" {
+				reg := prometheus.NewRegistry()
+				reg.MustRegister(session.Collectors()...)
+				go func() {
+					slog.Info("serving metrics", "addr", metrics)
+					err := http.ListenAndServe(metrics, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+					slog.Error("metrics", "err", err)
+				}()
+			}
+
+			if saved != nil {
+				if err := session.Resume(saved); err != nil {
+					fatal("cast", "err", err)
+				}
+			}
+
+			if at != "" {
+				startsAt, err := caster.ParseStartTime(at, time.Now())
+				if err != nil {
+					fatal("cast", "err", err)
+				}
+				if err := session.Schedule(startsAt); err != nil {
+					fatal("cast", "err", err)
+				}
 			}
 
 			sigChan := make(chan os.Signal, 1)
-			signal.Notify(sigChan, os.Interrupt, syscall.SIGINT)
-			<-sigChan
-			log.Println("Caught SIGINT, shutting down...")
-			if err := session.Shutdown(); err != nil {
-				log.Fatal("cast:", err)
+			signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+			sig := <-sigChan
+			slog.Info("shutting down", "signal", sig.String())
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- session.Shutdown(shutdownCtx) }()
+			select {
+			case err := <-done:
+				if err != nil {
+					fatal("cast", "err", err)
+				}
+			case <-shutdownCtx.Done():
+				fatal("cast: shutdown timed out")
+			case <-sigChan:
+				fatal("cast: forced shutdown")
 			}
 		},
 	}
 	cmd.Flags().StringVar(&title, "title", "", "title to use for the session")
+	cmd.Flags().StringVar(&protocol, "protocol", caster.ProtocolRTMP, "protocol to publish with (rtmp or whip via ingress, or webrtc directly)")
+	cmd.Flags().StringVar(&normalize, "normalize", "", "audio loudness normalization (loudnorm or dynaudnorm)")
+	cmd.Flags().BoolVar(&osd, "osd", false, "burn a VCR-style on-screen display into the video")
+	cmd.Flags().BoolVar(&slate, "slate", false, "stream a title card while no tape is playing")
+	cmd.Flags().StringVar(&slateImage, "slate-image", "", "image or looping video to show on the slate, implies --slate")
+	cmd.Flags().IntVar(&countdown, "countdown", 0, "seconds of countdown leader before /play starts a tape")
+	cmd.Flags().BoolVar(&fastSeek, "fast-seek", false, "land seeks on the nearest keyframe instead of the exact position")
+	cmd.Flags().BoolVar(&resume, "resume", false, "resume the room's last saved file and position")
+	cmd.Flags().StringVar(&metrics, "metrics", "", "address to serve Prometheus metrics on, like :9092 (disabled if empty)")
+	cmd.Flags().StringVar(&at, "at", "", "wall-clock time to start playing, like 20:00 or 8pm")
+	logFlags(cmd)
 	return cmd
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	lksdk2 "github.com/livekit/server-sdk-go/v2"
+)
+
+// chatReplay is how many recent messages are replayed to new participants.
+const chatReplay = 50
+
+var (
+	dataDir string
+
+	// chatLogs holds the *chatLog of each room
+	chatLogs sync.Map
+)
+
+// chatEntry is a chat message as recorded in a room's history. The fields
+// follow LiveKit's chat messages, with the sender's name at the time.
+type chatEntry struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Identity  string `json:"identity"`
+	Name      string `json:"name,omitempty"`
+	Message   string `json:"message"`
+}
+
+// chatLog records a room's chat to a file per cast session under the data
+// dir and keeps the most recent messages for replay.
+type chatLog struct {
+	sessionLog
+
+	recentMu sync.Mutex
+	loaded   bool
+	recent   []chatEntry
+}
+
+func roomChatLog(room string) *chatLog {
+	v, _ := chatLogs.LoadOrStore(room, &chatLog{
+		sessionLog: sessionLog{dir: roomDataDir("chat", room)},
+	})
+	return v.(*chatLog)
+}
+
+func (c *chatLog) add(e chatEntry) {
+	c.recentMu.Lock()
+	c.loadLocked()
+	c.recent = append(c.recent, e)
+	if len(c.recent) > chatReplay {
+		c.recent = slices.Clone(c.recent[len(c.recent)-chatReplay:])
+	}
+	c.recentMu.Unlock()
+	if err := c.append(e); err != nil {
+		slog.Error("chat log", "err", err)
+	}
+}
+
+// history returns the most recent messages, oldest first.
+func (c *chatLog) history() []chatEntry {
+	c.recentMu.Lock()
+	defer c.recentMu.Unlock()
+	c.loadLocked()
+	return slices.Clone(c.recent)
+}
+
+// start starts the session's transcript, loading the history first so the
+// new, empty transcript doesn't hide it.
+func (c *chatLog) start(session string) error {
+	c.recentMu.Lock()
+	c.loadLocked()
+	c.recentMu.Unlock()
+	return c.sessionLog.start(session)
+}
+
+// loadLocked seeds the recent messages from the last transcripts, so history
+// survives restarts of the server.
+func (c *chatLog) loadLocked() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	sessions, err := logSessions(c.dir)
+	if err != nil {
+		return
+	}
+	current := c.current()
+	var recent []chatEntry
+	for i := len(sessions) - 1; i >= 0 && len(recent) < chatReplay; i-- {
+		if sessions[i] == current {
+			continue
+		}
+		entries, err := readSessionLog[chatEntry](c.dir, sessions[i])
+		if err != nil {
+			slog.Warn("chat history", "dir", c.dir, "session", sessions[i], "err", err)
+			continue
+		}
+		recent = append(entries, recent...)
+	}
+	c.recent = recent[max(0, len(recent)-chatReplay):]
+}
+
+// displayName returns the name a participant chose in the UI, which keeps
+// it in their metadata.
+func displayName(p *lksdk2.RemoteParticipant) string {
+	if p == nil {
+		return ""
+	}
+	var md struct {
+		DisplayName string `json:"displayName"`
+	}
+	if json.Unmarshal([]byte(p.Metadata()), &md) == nil && md.DisplayName != "" {
+		return md.DisplayName
+	}
+	return p.Name()
+}
+
+// handleChatHistory serves the room's recent chat for participants joining
+// late.
+func handleChatHistory(w http.ResponseWriter, r *http.Request) {
+	room := r.URL.Query().Get("room")
+	if room == "" {
+		http.NotFound(w, r)
+		return
+	}
+	// anyone can ask, so only rooms with a caster get a chatLog
+	c, ok := chatLogs.Load(room)
+	if !ok {
+		c = &chatLog{sessionLog: sessionLog{dir: roomDataDir("chat", room)}}
+	}
+	history := c.(*chatLog).history()
+	if history == nil {
+		history = []chatEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(history)
+}
+
+// handleTranscript serves GET /-/api/admin/rooms/<room>/transcript, the
+// chat of the session given by ?session= or the latest one, as plain text
+// or with ?format=jsonl as recorded. ?session=list lists the sessions.
+func handleTranscript(w http.ResponseWriter, r *http.Request, room string) {
+	dir := roomDataDir("chat", room)
+	sessions, err := logSessions(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session := r.URL.Query().Get("session")
+	if session == "list" {
+		if sessions == nil {
+			sessions = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+		return
+	}
+	if session == "" && len(sessions) > 0 {
+		session = sessions[len(sessions)-1]
+	}
+	if !slices.Contains(sessions, session) {
+		http.Error(w, "no transcript for session", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "jsonl" {
+		f, err := os.Open(filepath.Join(dir, session+".jsonl"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		w.Header().Set("Content-Type", "application/jsonl")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", room+"-"+session+".jsonl"))
+		io.Copy(w, f)
+		return
+	}
+
+	entries, err := readSessionLog[chatEntry](dir, session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", room+"-"+session+".txt"))
+	for _, e := range entries {
+		fmt.Fprintf(w, "[%s] %s: %s\n",
+			time.UnixMilli(e.Timestamp).Format(time.DateTime),
+			cmp.Or(e.Name, e.Identity),
+			e.Message)
+	}
+}
@@ -1,3 +1,220 @@
 package main
 
-// todo
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+const dockerDataDir = "/data"
+
+var (
+	dockerName string
+	dockerPort int
+)
+
+// dockerEnv is passed through to the container when set. The image runs
+// livekit-server in dev mode, so its keys are always the dev keys.
+var dockerEnv = []string{
+	"PUBLIC_URL",
+	"NGROK_TOKEN",
+	"TAPECAFE_API_TOKEN",
+	"TAPECAFE_LOG_LEVEL",
+	"TAPECAFE_LOG_FORMAT",
+}
+
+func dockerCmd() *cli.Command {
+	cmd := &cli.Command{
+		Usage: "docker",
+		Short: "host a cafe in a container with docker or podman",
+	}
+	cmd.AddCommand(dockerUpCmd())
+	cmd.AddCommand(dockerLogsCmd())
+	cmd.AddCommand(dockerStopCmd())
+	return cmd
+}
+
+func dockerUpCmd() *cli.Command {
+	var (
+		image    string
+		buildCtx string
+		build    bool
+		pull     bool
+		data     string
+		rtcTCP   int
+		rtcUDP   int
+	)
+	cmd := &cli.Command{
+		Usage: "up",
+		Short: "build the image if needed and run it in the background",
+		Run: func(ctx *cli.Context, args []string) {
+			engine, err := dockerEngine()
+			if err != nil {
+				fatal("docker", "err", err)
+			}
+			if !build && !pull && !dockerImageExists(engine, image) {
+				if _, err := os.Stat(filepath.Join(buildCtx, "Dockerfile")); err != nil {
+					fatal("docker: no image to run, pass --context a checkout of the repo to build it from, or --pull for a published --image", "image", image)
+				}
+				build = true
+			}
+			switch {
+			case build:
+				err = dockerRun(engine, "build", "-t", image, buildCtx)
+			case pull:
+				err = dockerRun(engine, "pull", image)
+			}
+			if err != nil {
+				fatal("docker", "err", err)
+			}
+
+			if data == "" {
+				cache, err := os.UserCacheDir()
+				if err != nil {
+					fatal("docker", "err", err)
+				}
+				data = filepath.Join(cache, "tapecafe", "docker")
+			}
+			if err := os.MkdirAll(data, 0755); err != nil {
+				fatal("docker", "err", err)
+			}
+			data, err = filepath.Abs(data)
+			if err != nil {
+				fatal("docker", "err", err)
+			}
+			// LiveKit advertises its media ports to clients, so it listens on
+			// the host's ports in the container too
+			serverConfig := filepath.Join(data, "livekit-server.yml")
+			config := fmt.Sprintf(livekitServerConfig, "localhost:6379") +
+				fmt.Sprintf("rtc:\n  tcp_port: %d\n  udp_port: %d\n", rtcTCP, rtcUDP)
+			if err := os.WriteFile(serverConfig, []byte(config), 0644); err != nil {
+				fatal("docker", "err", err)
+			}
+
+			// replace a container left over from a previous up
+			exec.Command(engine, "rm", "-f", dockerName).Run()
+			runArgs := []string{
+				"run", "-d",
+				"--name", dockerName,
+				"--restart", "unless-stopped",
+				"-p", fmt.Sprintf("%d:9091", dockerPort),
+				"-p", fmt.Sprintf("%d:%d", rtcTCP, rtcTCP),
+				"-p", fmt.Sprintf("%d:%d/udp", rtcUDP, rtcUDP),
+				"-v", data + ":" + dockerDataDir,
+				"-v", serverConfig + ":/app/livekit-server.yml:ro",
+				"-e", "XDG_CACHE_HOME=" + dockerDataDir,
+				"-e", fmt.Sprintf("LIVEKIT_KEYS=%s: %s", lkAPIKey, lkAPISecret),
+			}
+			for _, name := range dockerEnv {
+				if v := os.Getenv(name); v != "" {
+					runArgs = append(runArgs, "-e", name+"="+v)
+				}
+			}
+			runArgs = append(runArgs, image)
+			if err := dockerRun(engine, runArgs...); err != nil {
+				fatal("docker", "err", err)
+			}
+
+			switch {
+			case os.Getenv("PUBLIC_URL") != "":
+				fmt.Printf("Cafe is up at %s\n", os.Getenv("PUBLIC_URL"))
+			case os.Getenv("NGROK_TOKEN") != "":
+				fmt.Println("Cafe is up, its ngrok URL is in `tapecafe docker logs`")
+			default:
+				fmt.Printf("Cafe is up at http://localhost:%d\n", dockerPort)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&image, "image", "tapecafe", "image to run, built from --context unless it exists or --pull is set")
+	cmd.Flags().StringVar(&buildCtx, "context", ".", "checkout of the repo to build the image from")
+	cmd.Flags().BoolVar(&build, "build", false, "build the image even if it exists")
+	cmd.Flags().BoolVar(&pull, "pull", false, "pull the image even if it exists")
+	cmd.Flags().StringVar(&data, "data", "", "directory to keep the container's cache in (default is the user cache dir)")
+	cmd.Flags().IntVar(&dockerPort, "port", 9091, "host port to publish the server on")
+	cmd.Flags().IntVar(&rtcTCP, "rtc-tcp-port", 7881, "host port for LiveKit's WebRTC over TCP")
+	cmd.Flags().IntVar(&rtcUDP, "rtc-udp-port", 7882, "host port for LiveKit's WebRTC over UDP")
+	dockerFlags(cmd)
+	return cmd
+}
+
+func dockerLogsCmd() *cli.Command {
+	var follow bool
+	cmd := &cli.Command{
+		Usage: "logs",
+		Short: "show the container's logs",
+		Run: func(ctx *cli.Context, args []string) {
+			engine, err := dockerEngine()
+			if err != nil {
+				fatal("docker", "err", err)
+			}
+			logsArgs := []string{"logs"}
+			if follow {
+				logsArgs = append(logsArgs, "-f")
+			}
+			if err := dockerRun(engine, append(logsArgs, dockerName)...); err != nil {
+				fatal("docker", "err", err)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&follow, "follow", false, "keep showing new logs")
+	dockerFlags(cmd)
+	return cmd
+}
+
+func dockerStopCmd() *cli.Command {
+	cmd := &cli.Command{
+		Usage: "stop",
+		Short: "stop and remove the container",
+		Run: func(ctx *cli.Context, args []string) {
+			engine, err := dockerEngine()
+			if err != nil {
+				fatal("docker", "err", err)
+			}
+			if err := dockerRun(engine, "stop", dockerName); err != nil {
+				fatal("docker", "err", err)
+			}
+			if err := dockerRun(engine, "rm", dockerName); err != nil {
+				fatal("docker", "err", err)
+			}
+		},
+	}
+	dockerFlags(cmd)
+	return cmd
+}
+
+func dockerFlags(cmd *cli.Command) {
+	cmd.Flags().StringVar(&dockerName, "name", "tapecafe", "name of the container")
+}
+
+// dockerEngine returns podman or docker, preferring podman like the
+// Makefile does. DOCKER_CMD overrides it.
+func dockerEngine() (string, error) {
+	if engine := os.Getenv("DOCKER_CMD"); engine != "" {
+		return engine, nil
+	}
+	path, err := exec.LookPath("podman")
+	if err != nil {
+		path, err = exec.LookPath("docker")
+	}
+	if err != nil {
+		return "", fmt.Errorf("neither podman nor docker found in PATH")
+	}
+	return path, nil
+}
+
+func dockerImageExists(engine, image string) bool {
+	return exec.Command(engine, "image", "inspect", image).Run() == nil
+}
+
+func dockerRun(engine string, args ...string) error {
+	cmd := exec.Command(engine, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", filepath.Base(engine), args[0], err)
+	}
+	return nil
+}
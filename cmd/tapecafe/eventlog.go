@@ -0,0 +1,119 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	lksdk2 "github.com/livekit/server-sdk-go/v2"
+	"github.com/progrium/tapecafe/caster"
+)
+
+const (
+	eventStart   = "start"
+	eventEnd     = "end"
+	eventState   = "state"
+	eventJoin    = "join"
+	eventLeave   = "leave"
+	eventCommand = "command"
+)
+
+// eventLogs holds the *eventLog of each room
+var eventLogs sync.Map
+
+// roomEvent is an entry of a room's event log. Identity and Name are who
+// joined, left or issued a command, which is "api" for the control API.
+type roomEvent struct {
+	Time     time.Time     `json:"time"`
+	Type     string        `json:"type"`
+	Identity string        `json:"identity,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Command  string        `json:"command,omitempty"`
+	Status   caster.Status `json:"status,omitempty"`
+	Title    string        `json:"title,omitempty"`
+	Position string        `json:"position,omitempty"`
+}
+
+// eventLog records what happens in a room to a file per cast session under
+// the data dir, for `tapecafe report`.
+type eventLog struct {
+	sessionLog
+
+	stateMu   sync.Mutex
+	lastState *caster.SharedState
+}
+
+func roomEventLog(room string) *eventLog {
+	v, _ := eventLogs.LoadOrStore(room, &eventLog{
+		sessionLog: sessionLog{dir: roomDataDir("events", room)},
+	})
+	return v.(*eventLog)
+}
+
+func (l *eventLog) start(session string) error {
+	l.stateMu.Lock()
+	l.lastState = nil
+	l.stateMu.Unlock()
+	if err := l.sessionLog.start(session); err != nil {
+		return err
+	}
+	l.record(roomEvent{Type: eventStart})
+	return nil
+}
+
+func (l *eventLog) end(session string) {
+	l.record(roomEvent{Type: eventEnd})
+	l.sessionLog.end(session)
+}
+
+func (l *eventLog) record(e roomEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if err := l.append(e); err != nil {
+		slog.Error("event log", "dir", l.dir, "err", err)
+	}
+}
+
+// state records the state if its status or title changed, leaving out the
+// position updates while playing and the ticks of a countdown.
+func (l *eventLog) state(state caster.SharedState) {
+	l.stateMu.Lock()
+	last := l.lastState
+	l.lastState = &state
+	l.stateMu.Unlock()
+	if last != nil && statusKind(last.Status) == statusKind(state.Status) && last.Title == state.Title {
+		return
+	}
+	l.record(roomEvent{
+		Type:     eventState,
+		Status:   state.Status,
+		Title:    state.Title,
+		Position: state.Position,
+	})
+}
+
+// statusKind strips the remaining time from countdown and scheduled
+// statuses.
+func statusKind(status caster.Status) caster.Status {
+	for _, kind := range []caster.Status{caster.StatusCountdown, caster.StatusScheduled} {
+		if strings.HasPrefix(string(status), string(kind)) {
+			return kind
+		}
+	}
+	return status
+}
+
+// recordPresence records a participant joining or leaving, leaving out the
+// caster.
+func recordPresence(l *eventLog, typ string, p *lksdk2.RemoteParticipant) {
+	if p.Identity() == ingressIdentity {
+		return
+	}
+	l.record(roomEvent{
+		Type:     typ,
+		Identity: p.Identity(),
+		Name:     displayName(p),
+	})
+}
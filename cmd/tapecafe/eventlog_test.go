@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/progrium/tapecafe/caster"
+)
+
+func TestEventLogStateSkipsTicks(t *testing.T) {
+	dir := t.TempDir()
+	l := &eventLog{sessionLog: sessionLog{dir: dir}}
+	if err := l.start("s1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []caster.Status{
+		caster.StatusReady,
+		"⏲ STARTS IN 00:00:03",
+		"⏲ STARTS IN 00:00:02",
+		"⏲ STARTS IN 00:00:01",
+		"⏳ STARTING IN 3",
+		"⏳ STARTING IN 2",
+		caster.StatusPlaying,
+		caster.StatusPlaying,
+	} {
+		l.state(caster.SharedState{Status: status, Title: "Tape"})
+	}
+	l.end("s1")
+
+	events, err := readSessionLog[roomEvent](dir, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []caster.Status
+	for _, e := range events {
+		if e.Type == eventState {
+			got = append(got, e.Status)
+		}
+	}
+	want := []caster.Status{caster.StatusReady, "⏲ STARTS IN 00:00:03", "⏳ STARTING IN 3", caster.StatusPlaying}
+	if len(got) != len(want) {
+		t.Fatalf("recorded %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("recorded %q, want %q", got, want)
+		}
+	}
+}
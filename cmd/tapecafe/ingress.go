@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	lkp "github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+const (
+	ingressSuffix   = "-ingress"
+	ingressIdentity = "caster"
+)
+
+var (
+	ingressIdle   time.Duration
+	rotateIngress bool
+
+	// ingresses holds the *lkp.IngressInfo created for each room
+	ingresses    sync.Map
+	ingressMu    sync.Mutex
+	ingressTimer = map[string]*time.Timer{}
+)
+
+func ingressClient() *lksdk.IngressClient {
+	return lksdk.NewIngressClient(lkAPIURL, lkAPIKey, lkAPISecret)
+}
+
+// ensureIngress returns the stream key of the room's ingress, creating one
+// if there is none, if it has a different input type, or if keys are
+// rotated for every cast session.
+func ensureIngress(room string, inputType lkp.IngressInput) (string, error) {
+	ingressMu.Lock()
+	defer ingressMu.Unlock()
+	if t, ok := ingressTimer[room]; ok {
+		t.Stop()
+		delete(ingressTimer, room)
+	}
+
+	ctx := context.TODO()
+	if v, ok := ingresses.Load(room); ok {
+		ingress := v.(*lkp.IngressInfo)
+		if !rotateIngress && ingress.GetInputType() == inputType {
+			return ingress.GetStreamKey(), nil
+		}
+		if err := deleteIngressLocked(ctx, room); err != nil {
+			return "", err
+		}
+	}
+
+	req := &lkp.CreateIngressRequest{
+		InputType:           inputType,
+		Name:                room + ingressSuffix,
+		RoomName:            room,
+		ParticipantIdentity: ingressIdentity,
+	}
+	if inputType == lkp.IngressInput_WHIP_INPUT {
+		// pass WHIP media straight through for lower latency
+		transcode := false
+		req.EnableTranscoding = &transcode
+	}
+	ingress, err := ingressClient().CreateIngress(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("created ingress", "room", room, "ingress", ingress.GetIngressId(), "url", ingress.GetUrl())
+	ingresses.Store(room, ingress)
+
+	return ingress.GetStreamKey(), nil
+}
+
+// releaseIngress deletes the room's ingress once it has been idle for
+// ingressIdle, unless a caster connects to the room again before then.
+func releaseIngress(room string) {
+	ingressMu.Lock()
+	defer ingressMu.Unlock()
+	if _, ok := ingresses.Load(room); !ok {
+		return
+	}
+	if t, ok := ingressTimer[room]; ok {
+		t.Stop()
+	}
+	ingressTimer[room] = time.AfterFunc(ingressIdle, func() {
+		ingressMu.Lock()
+		defer ingressMu.Unlock()
+		delete(ingressTimer, room)
+		if _, ok := casters.Load(room); ok {
+			return
+		}
+		slog.Info("deleting idle ingress", "room", room)
+		if err := deleteIngressLocked(context.TODO(), room); err != nil {
+			slog.Error("delete ingress", "room", room, "err", err)
+		}
+	})
+}
+
+// deleteIngress deletes the ingress created for room, if any.
+func deleteIngress(ctx context.Context, room string) error {
+	ingressMu.Lock()
+	defer ingressMu.Unlock()
+	if t, ok := ingressTimer[room]; ok {
+		t.Stop()
+		delete(ingressTimer, room)
+	}
+	return deleteIngressLocked(ctx, room)
+}
+
+func deleteIngressLocked(ctx context.Context, room string) error {
+	v, ok := ingresses.Load(room)
+	if !ok {
+		return nil
+	}
+	if _, err := ingressClient().DeleteIngress(ctx, &lkp.DeleteIngressRequest{
+		IngressId: v.(*lkp.IngressInfo).GetIngressId(),
+	}); err != nil {
+		return err
+	}
+	ingresses.Delete(room)
+	return nil
+}
+
+// reconcileIngresses adopts the ingresses this server created before it was
+// restarted, deleting duplicates, and arms their idle timeout.
+func reconcileIngresses() error {
+	ctx := context.TODO()
+	client := ingressClient()
+	resp, err := client.ListIngress(ctx, &lkp.ListIngressRequest{})
+	if err != nil {
+		return err
+	}
+	for _, ingress := range resp.GetItems() {
+		room := ingress.GetRoomName()
+		if ingress.GetName() != room+ingressSuffix || ingress.GetParticipantIdentity() != ingressIdentity {
+			continue
+		}
+		if _, loaded := ingresses.LoadOrStore(room, ingress); loaded {
+			slog.Info("deleting duplicate ingress", "room", room, "ingress", ingress.GetIngressId())
+			if _, err := client.DeleteIngress(ctx, &lkp.DeleteIngressRequest{
+				IngressId: ingress.GetIngressId(),
+			}); err != nil {
+				slog.Error("delete ingress", "room", room, "err", err)
+			}
+			continue
+		}
+		slog.Info("adopted ingress", "room", room, "ingress", ingress.GetIngressId())
+		releaseIngress(room)
+	}
+	return nil
+}
+
+// closeIngresses deletes the ingresses of every room, for shutdown.
+func closeIngresses(ctx context.Context) {
+	ingressMu.Lock()
+	defer ingressMu.Unlock()
+	for room, t := range ingressTimer {
+		t.Stop()
+		delete(ingressTimer, room)
+	}
+	ingresses.Range(func(key, _ any) bool {
+		room := key.(string)
+		if err := deleteIngressLocked(ctx, room); err != nil {
+			slog.Error("delete ingress", "room", room, "err", err)
+		}
+		return true
+	})
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.ngrok.com/ngrok"
+	ngrokconfig "golang.ngrok.com/ngrok/config"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+const (
+	// tunnelTimeout bounds waiting for a tunnel command to print its URL.
+	tunnelTimeout = 30 * time.Second
+	// tunnelSettle is how long a tunnel command's output has to go without
+	// another URL for the last one to be taken as the tunnel's.
+	tunnelSettle = 2 * time.Second
+)
+
+var (
+	listenVia        string
+	unixSocket       string
+	tunnelCommand    string
+	tunnelURL        string
+	tunnelURLPattern string
+)
+
+// listenerProviders open the listener serve accepts connections on. The
+// listeners they return report their public URL with a URL method.
+var listenerProviders = map[string]func(ctx context.Context) (net.Listener, error){
+	"tcp":     listenTCP,
+	"unix":    listenUnix,
+	"ngrok":   listenNgrok,
+	"command": listenCommand,
+}
+
+func listenerFlags(cmd *cli.Command) {
+	cmd.Flags().StringVar(&listenVia, "listen", "", "how to listen: tcp, unix, ngrok or command (default ngrok if NGROK_TOKEN is set, tcp otherwise)")
+	cmd.Flags().StringVar(&unixSocket, "unix-socket", "", "socket path to listen on with --listen unix")
+	cmd.Flags().StringVar(&tunnelCommand, "tunnel-command", "", "command that tunnels to $TAPECAFE_PORT and prints its https URL, like an ssh -R to a tunnel host")
+	cmd.Flags().StringVar(&tunnelURL, "tunnel-url", "", "public URL of the tunnel command, if it doesn't print one")
+	cmd.Flags().StringVar(&tunnelURLPattern, "tunnel-url-pattern", `https://[^\s"'<>]+`, "regexp matching the public URL in the tunnel command's output")
+}
+
+// urlListener is a listener that knows the URL it is reachable at.
+type urlListener struct {
+	net.Listener
+	url   string
+	close func()
+}
+
+func (l *urlListener) URL() string {
+	return l.url
+}
+
+func (l *urlListener) Close() error {
+	if l.close != nil {
+		l.close()
+	}
+	return l.Listener.Close()
+}
+
+func listenerProvider() (string, error) {
+	name := listenVia
+	if name == "" {
+		switch {
+		case tunnelCommand != "":
+			name = "command"
+		case unixSocket != "":
+			name = "unix"
+		case os.Getenv("NGROK_TOKEN") != "" && os.Getenv("PUBLIC_URL") == "" && !tlsEnabled():
+			name = "ngrok"
+		default:
+			name = "tcp"
+		}
+	}
+	if _, ok := listenerProviders[name]; !ok {
+		names := make([]string, 0, len(listenerProviders))
+		for n := range listenerProviders {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return "", fmt.Errorf("unknown listener %q, use one of %s", name, strings.Join(names, ", "))
+	}
+	if tlsEnabled() && name != "tcp" {
+		return "", fmt.Errorf("TLS is only served with --listen tcp, not %s", name)
+	}
+	return name, nil
+}
+
+func listenTCP(ctx context.Context) (net.Listener, error) {
+	l, err := net.Listen("tcp4", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	hostname := strings.ReplaceAll(l.Addr().String(), "0.0.0.0", "localhost")
+	if tlsEnabled() {
+		config, err := setupTLS()
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, config)
+		scheme = "https"
+		if autocertDomains != "" {
+			hostname = tlsHost(l.Addr())
+		}
+	}
+	return &urlListener{
+		Listener: l,
+		url:      fmt.Sprintf("%s://%s", scheme, hostname),
+	}, nil
+}
+
+// listenUnix listens on a unix socket for a reverse proxy in front of serve,
+// which only the proxy knows the public URL of.
+func listenUnix(ctx context.Context) (net.Listener, error) {
+	if unixSocket == "" {
+		return nil, errors.New("--listen unix needs --unix-socket")
+	}
+	if os.Getenv("PUBLIC_URL") == "" {
+		return nil, errors.New("--listen unix needs PUBLIC_URL set to the URL of the proxy in front of it")
+	}
+	// a socket left behind by an unclean exit would fail the listen
+	if conn, err := net.Dial("unix", unixSocket); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use", unixSocket)
+	}
+	os.Remove(unixSocket)
+	l, err := net.Listen("unix", unixSocket)
+	if err != nil {
+		return nil, err
+	}
+	return &urlListener{Listener: l, url: os.Getenv("PUBLIC_URL")}, nil
+}
+
+func listenNgrok(ctx context.Context) (net.Listener, error) {
+	token := os.Getenv("NGROK_TOKEN")
+	if token == "" {
+		return nil, errors.New("--listen ngrok needs NGROK_TOKEN")
+	}
+	// the ngrok tunnel reports its URL itself
+	return ngrok.Listen(ctx,
+		ngrokconfig.HTTPEndpoint(),
+		ngrok.WithAuthtoken(token),
+	)
+}
+
+// listenCommand listens on bindAddr and runs the tunnel command, which is
+// given the port as TAPECAFE_PORT. Unless --tunnel-url is set, the public URL
+// is the last URL matching --tunnel-url-pattern the command prints before its
+// output settles, since tunnels tend to print links to their docs first. The
+// command and whatever it started are stopped when the listener is closed.
+func listenCommand(ctx context.Context) (net.Listener, error) {
+	if tunnelCommand == "" {
+		return nil, errors.New("--listen command needs --tunnel-command")
+	}
+	pattern, err := regexp.Compile(tunnelURLPattern)
+	if err != nil {
+		return nil, fmt.Errorf("--tunnel-url-pattern: %w", err)
+	}
+	l, err := net.Listen("tcp4", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	shell := []string{"sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/C"}
+	}
+	cmd := exec.Command(shell[0], shell[1], tunnelCommand)
+	cmd.Env = append(os.Environ(), "TAPECAFE_PORT="+port)
+	cmd.SysProcAttr = tunnelProcAttr()
+	// don't wait on the output of processes that outlive the kill
+	cmd.WaitDelay = time.Second
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		l.Close()
+		return nil, err
+	}
+	var stopped atomic.Bool
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		close(exited)
+		if !stopped.Load() {
+			slog.Warn("tunnel command exited", "err", err)
+		}
+	}()
+	stop := func() {
+		stopped.Store(true)
+		killTunnel(cmd.Process)
+		<-exited
+	}
+
+	found := make(chan string, 1)
+	go func() {
+		log := slog.With("component", "tunnel")
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			log.Info(line)
+			if urls := pattern.FindAllString(line, -1); urls != nil {
+				// replace a URL that wasn't taken yet
+				select {
+				case <-found:
+				default:
+				}
+				found <- urls[len(urls)-1]
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	url := tunnelURL
+	timeout := time.After(tunnelTimeout)
+	var settled <-chan time.Time
+	for url == "" || settled != nil {
+		select {
+		case url = <-found:
+			settled = time.After(tunnelSettle)
+		case <-settled:
+			settled = nil
+		case <-exited:
+			l.Close()
+			if url != "" {
+				return nil, fmt.Errorf("tunnel command exited after printing %s", url)
+			}
+			return nil, errors.New("tunnel command exited before printing its URL")
+		case <-timeout:
+			if url != "" {
+				settled = nil
+				continue
+			}
+			stop()
+			l.Close()
+			return nil, errors.New("tunnel command didn't print its URL, set --tunnel-url")
+		}
+	}
+	return &urlListener{Listener: l, url: url, close: stop}, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListenerProvider(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		listen  string
+		tunnel  string
+		socket  string
+		cert    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "tcp"},
+		{name: "ngrok token", env: map[string]string{"NGROK_TOKEN": "t"}, want: "ngrok"},
+		{name: "ngrok token with public url", env: map[string]string{"NGROK_TOKEN": "t", "PUBLIC_URL": "https://example.com"}, want: "tcp"},
+		{name: "ngrok token with tls", cert: "cert.pem", env: map[string]string{"NGROK_TOKEN": "t"}, want: "tcp"},
+		{name: "tunnel command", tunnel: "ssh -R 80:localhost:$TAPECAFE_PORT example.com", env: map[string]string{"NGROK_TOKEN": "t"}, want: "command"},
+		{name: "unix socket", socket: "/tmp/tapecafe.sock", want: "unix"},
+		{name: "explicit", listen: "ngrok", want: "ngrok"},
+		{name: "unknown", listen: "carrier-pigeon", wantErr: true},
+		{name: "tls over unix", listen: "unix", cert: "cert.pem", wantErr: true},
+		{name: "tls over tcp", listen: "tcp", cert: "cert.pem", want: "tcp"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NGROK_TOKEN", tt.env["NGROK_TOKEN"])
+			t.Setenv("PUBLIC_URL", tt.env["PUBLIC_URL"])
+			listenVia, tunnelCommand, unixSocket, tlsCert = tt.listen, tt.tunnel, tt.socket, tt.cert
+			defer func() {
+				listenVia, tunnelCommand, unixSocket, tlsCert = "", "", "", ""
+			}()
+			got, err := listenerProvider()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListenCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bindAddr = "127.0.0.1:0"
+	tunnelURLPattern = `https://[^\s"'<>]+`
+	// a docs link before the tunnel's URL, and a process outliving the shell
+	tunnelCommand = `echo "see https://docs.example.com/tunnels"; sleep 0.2; echo "url: https://$TAPECAFE_PORT.tunnel.example"; sleep 30 & sleep 30`
+	defer func() { tunnelCommand = "" }()
+
+	l, err := listenCommand(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := l.(interface{ URL() string }).URL()
+	if want := "https://" + portOf(l.Addr().String()) + ".tunnel.example"; url != want {
+		t.Errorf("URL() = %q, want %q", url, want)
+	}
+
+	closed := make(chan error)
+	go func() { closed <- l.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close didn't return once the tunnel command was killed")
+	}
+}
+
+func TestListenCommandExits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+	bindAddr = "127.0.0.1:0"
+	tunnelURLPattern = `https://[^\s"'<>]+`
+	defer func() { tunnelCommand = "" }()
+	for _, tt := range []struct {
+		command, want string
+	}{
+		{`echo "no tunnel for you"`, "exited before printing its URL"},
+		{`echo "url: https://tunnel.example"; sleep 0.2`, "exited after printing https://tunnel.example"},
+	} {
+		tunnelCommand = tt.command
+		l, err := listenCommand(context.Background())
+		if err == nil {
+			l.Close()
+			t.Errorf("%s: listened", tt.command)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.command, err, tt.want)
+		}
+	}
+}
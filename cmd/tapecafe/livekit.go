@@ -1,20 +1,251 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/progrium/tapecafe/supervisor"
 	"tractor.dev/toolkit-go/engine/cli"
 )
 
+const livekitServerConfig = `bind_addresses:
+  - "0.0.0.0"
+redis:
+  address: "%s"
+ingress:
+  rtmp_base_url: "rtmp://localhost:1935/live"
+  whip_base_url: "http://localhost:8080/whip"
+`
+
+const livekitIngressConfig = `log_level: info
+api_key: %s
+api_secret: %s
+ws_url: ws://localhost:7880
+redis:
+  address: %s
+`
+
+var withLiveKit bool
+
 func livekitCmd() *cli.Command {
 	cmd := &cli.Command{
-		Usage: "livekit ...",
-		// Short: "",
-		// Args: cli.MinArgs(1),
+		Usage:  "livekit",
+		Short:  "run redis, livekit-server and ingress for local development",
 		Hidden: true,
+	}
+	cmd.AddCommand(livekitUpCmd())
+	cmd.AddCommand(livekitDownCmd())
+	cmd.AddCommand(livekitStatusCmd())
+	return cmd
+}
+
+func livekitUpCmd() *cli.Command {
+	cmd := &cli.Command{
+		Usage: "up",
+		Short: "start and supervise the LiveKit services until interrupted",
 		Run: func(ctx *cli.Context, args []string) {
-			fmt.Println("livekit!")
+			if err := setupLogging(); err != nil {
+				fatal("livekit", "err", err)
+			}
+			dir, err := livekitDir()
+			if err != nil {
+				fatal("livekit", "err", err)
+			}
+			if pid, ok := livekitPid(dir); ok {
+				fatal("livekit: already up", "pid", pid)
+			}
+			pidfile := filepath.Join(dir, "supervisor.pid")
+			if err := os.WriteFile(pidfile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+				fatal("livekit", "err", err)
+			}
+			defer os.Remove(pidfile)
+
+			sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			sup, err := startLiveKit(sigCtx, dir)
+			if err != nil {
+				stop()
+				sup.Wait()
+				os.Remove(pidfile)
+				fatal("livekit", "err", err)
+			}
+			fmt.Println("LiveKit is up, interrupt or run `tapecafe livekit down` to stop")
+			<-sigCtx.Done()
+			sup.Wait()
 		},
 	}
+	logFlags(cmd)
 	return cmd
 }
+
+func livekitDownCmd() *cli.Command {
+	return &cli.Command{
+		Usage: "down",
+		Short: "stop the LiveKit services started by up",
+		Run: func(ctx *cli.Context, args []string) {
+			dir, err := livekitDir()
+			if err != nil {
+				fatal("livekit", "err", err)
+			}
+			pid, ok := livekitPid(dir)
+			if !ok {
+				fmt.Println("LiveKit is not up")
+				return
+			}
+			p, err := os.FindProcess(pid)
+			if err != nil {
+				fatal("livekit", "err", err)
+			}
+			if err := p.Signal(syscall.SIGTERM); err != nil {
+				fatal("livekit", "err", err)
+			}
+			deadline := time.Now().Add(15 * time.Second)
+			for time.Now().Before(deadline) {
+				if _, ok := livekitPid(dir); !ok {
+					fmt.Println("LiveKit is down")
+					return
+				}
+				time.Sleep(250 * time.Millisecond)
+			}
+			fatal("livekit: still running", "pid", pid)
+		},
+	}
+}
+
+func livekitStatusCmd() *cli.Command {
+	return &cli.Command{
+		Usage: "status",
+		Short: "show whether the LiveKit services are up",
+		Run: func(ctx *cli.Context, args []string) {
+			dir, err := livekitDir()
+			if err != nil {
+				fatal("livekit", "err", err)
+			}
+			if pid, ok := livekitPid(dir); ok {
+				fmt.Printf("supervisor  running (pid %d)\n", pid)
+			} else {
+				fmt.Println("supervisor  not running")
+			}
+			down := false
+			for _, p := range probes {
+				probeCtx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+				err := p.probe(probeCtx)
+				cancel()
+				if err != nil {
+					down = true
+					fmt.Printf("%-10s  down (%s)\n", p.name, err)
+					continue
+				}
+				fmt.Printf("%-10s  up\n", p.name)
+			}
+			if down {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// startLiveKit writes the configs to dir and starts redis, livekit-server
+// and ingress from the PATH, each once the one before is ready. The
+// returned supervisor stops them once ctx is done, even if starting failed.
+func startLiveKit(ctx context.Context, dir string) (*supervisor.Supervisor, error) {
+	serverConfig := filepath.Join(dir, "livekit-server.yml")
+	if err := os.WriteFile(serverConfig, []byte(fmt.Sprintf(livekitServerConfig, lkRedisAddr)), 0644); err != nil {
+		return &supervisor.Supervisor{}, err
+	}
+	ingressConfig := filepath.Join(dir, "livekit-ingress.yml")
+	if err := os.WriteFile(ingressConfig, []byte(fmt.Sprintf(livekitIngressConfig, lkAPIKey, lkAPISecret, lkRedisAddr)), 0644); err != nil {
+		return &supervisor.Supervisor{}, err
+	}
+	redis, err := supervisedRedis(ctx, dir)
+	if err != nil {
+		return &supervisor.Supervisor{}, err
+	}
+	sup := &supervisor.Supervisor{
+		Processes: append(redis,
+			supervisor.Process{
+				Name:  "livekit",
+				Path:  "livekit-server",
+				Args:  []string{"--dev", "--config", serverConfig},
+				Dir:   dir,
+				Ready: probeLiveKit,
+			},
+			supervisor.Process{
+				Name:  "ingress",
+				Path:  "ingress",
+				Args:  []string{"--config", ingressConfig},
+				Dir:   dir,
+				Ready: probeTCP(lkRTMPAddr),
+			},
+		),
+	}
+	return sup, sup.Start(ctx)
+}
+
+// supervisedRedis returns the redis process to supervise, or none if a redis
+// is already answering on lkRedisAddr, which LiveKit then shares.
+func supervisedRedis(ctx context.Context, dir string) ([]supervisor.Process, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	err := probeRedis(probeCtx)
+	if err == nil {
+		slog.Info("using the redis already running", "addr", lkRedisAddr)
+		return nil, nil
+	}
+	if conn, dialErr := net.DialTimeout("tcp", lkRedisAddr, time.Second); dialErr == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is in use by something other than redis: %w", lkRedisAddr, err)
+	}
+	return []supervisor.Process{{
+		Name:  "redis",
+		Path:  "redis-server",
+		Args:  []string{"--port", portOf(lkRedisAddr)},
+		Dir:   dir,
+		Ready: probeRedis,
+	}}, nil
+}
+
+// livekitDir holds the generated configs and the pid file of `livekit up`.
+func livekitDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "tapecafe", "livekit")
+	return dir, os.MkdirAll(dir, 0755)
+}
+
+// livekitPid returns the pid of a running `livekit up`, if any.
+func livekitPid(dir string) (int, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, "supervisor.pid"))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, false
+	}
+	if err := p.Signal(syscall.Signal(0)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return 0, false
+	}
+	return pid, true
+}
+
+func portOf(addr string) string {
+	_, port, _ := strings.Cut(addr, ":")
+	return port
+}
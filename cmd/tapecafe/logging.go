@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+var (
+	logLevel  string
+	logFormat string
+)
+
+// logFlags adds the logging flags to cmd, defaulting from the environment.
+func logFlags(cmd *cli.Command) {
+	cmd.Flags().StringVar(&logLevel, "log-level", cmp.Or(os.Getenv("TAPECAFE_LOG_LEVEL"), "info"), "log level (debug, info, warn or error)")
+	cmd.Flags().StringVar(&logFormat, "log-format", cmp.Or(os.Getenv("TAPECAFE_LOG_FORMAT"), "text"), "log format (text or json)")
+}
+
+// setupLogging installs the default slog logger from the logging flags.
+// The standard log package is routed through it as well.
+func setupLogging() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown log format: %s", logFormat)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// fatal logs msg as an error and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
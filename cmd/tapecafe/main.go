@@ -20,6 +20,8 @@ func main() {
 
 	root.AddCommand(serveCmd())
 	root.AddCommand(castCmd())
+	root.AddCommand(dockerCmd())
+	root.AddCommand(reportCmd())
 
 	// hidden commands
 	root.AddCommand(livekitCmd())
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/progrium/tapecafe/caster"
+	"github.com/progrium/tapecafe/server"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	rpcConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tapecafe_rpc_connections",
+		Help: "Caster RPC connections currently open.",
+	})
+	chatMessages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tapecafe_chat_messages_total",
+		Help: "Chat messages seen in rooms with a caster.",
+	})
+	commandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tapecafe_commands_total",
+		Help: "Caster commands issued, by command and where from.",
+	}, []string{"command", "source"})
+)
+
+// countCommand counts a caster command, folding unknown ones into "other"
+// to keep the number of series bounded.
+func countCommand(command, source string) {
+	if !caster.IsCommand(command) {
+		command = "other"
+	}
+	commandsTotal.WithLabelValues(strings.TrimPrefix(command, "/"), source).Inc()
+}
+
+// metricsHandler serves the server's metrics in the Prometheus format.
+func metricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcConnections,
+		chatMessages,
+		commandsTotal,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tapecafe_rooms",
+			Help: "Rooms with a caster connected.",
+		}, func() float64 {
+			return float64(countMap(&casters))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "tapecafe_state_subscribers",
+			Help: "State websocket connections across all rooms.",
+		}, func() float64 {
+			stateListenersMu.Lock()
+			defer stateListenersMu.Unlock()
+			n := 0
+			for _, listeners := range stateListeners {
+				n += countMap(listeners)
+			}
+			return float64(n)
+		}),
+	)
+	reg.MustRegister(server.Collectors()...)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+func countMap(m *sync.Map) int {
+	n := 0
+	m.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
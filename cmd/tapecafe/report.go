@@ -0,0 +1,233 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/progrium/tapecafe/caster"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+func reportCmd() *cli.Command {
+	var (
+		session string
+		all     bool
+		list    bool
+	)
+	cmd := &cli.Command{
+		Usage: "report <room>",
+		Short: "summarize a room's cast sessions from the server's event log",
+		Args:  cli.ExactArgs(1),
+		Run: func(ctx *cli.Context, args []string) {
+			room := args[0]
+			dir := roomDataDir("events", room)
+			sessions, err := logSessions(dir)
+			if err != nil {
+				fatal("report", "err", err)
+			}
+			if len(sessions) == 0 {
+				fatal("report: no sessions recorded", "room", room, "dir", dir)
+			}
+			if list {
+				for _, s := range sessions {
+					events, _ := readSessionLog[roomEvent](dir, s)
+					started := ""
+					if len(events) > 0 {
+						started = events[0].Time.Local().Format(time.DateTime)
+					}
+					fmt.Printf("%s  %s\n", s, started)
+				}
+				return
+			}
+			switch {
+			case all:
+			case session != "":
+				if !slices.Contains(sessions, session) {
+					fatal("report: no such session", "room", room, "session", session)
+				}
+				sessions = []string{session}
+			default:
+				sessions = sessions[len(sessions)-1:]
+			}
+			for i, s := range sessions {
+				events, err := readSessionLog[roomEvent](dir, s)
+				if err != nil {
+					fatal("report", "err", err)
+				}
+				if i > 0 {
+					fmt.Println()
+				}
+				printReport(os.Stdout, room, s, events)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&session, "session", "", "session to report on (default is the latest)")
+	cmd.Flags().BoolVar(&all, "all", false, "report on every recorded session")
+	cmd.Flags().BoolVar(&list, "list", false, "list the recorded sessions")
+	cmd.Flags().StringVar(&dataDir, "data-dir", defaultDataDir(), "directory serve keeps its data in")
+	return cmd
+}
+
+// attendee is a participant's time in a session.
+type attendee struct {
+	name     string
+	joined   time.Time
+	present  time.Duration
+	joinedAt time.Time // zero while not in the room
+}
+
+// watched is a tape's time in a session.
+type watched struct {
+	title   string
+	started time.Time
+	played  time.Duration
+}
+
+// printReport writes a summary of a session's events: when it ran, what was
+// watched and for how long, who attended, and a timeline.
+func printReport(w io.Writer, room, session string, events []roomEvent) {
+	if len(events) == 0 {
+		fmt.Fprintf(w, "Session %s in %s has no events\n", session, room)
+		return
+	}
+	start, end := events[0].Time, events[len(events)-1].Time
+	ended := events[len(events)-1].Type == eventEnd
+
+	var (
+		people   []*attendee
+		byID     = map[string]*attendee{}
+		tapes    []*watched
+		byTitle  = map[string]*watched{}
+		playing  *watched
+		since    time.Time
+		pauses   int
+		seeks    int
+		commands = map[string]int{}
+	)
+	for _, e := range events {
+		switch e.Type {
+		case eventJoin:
+			a, ok := byID[e.Identity]
+			if !ok {
+				a = &attendee{joined: e.Time}
+				byID[e.Identity] = a
+				people = append(people, a)
+			}
+			a.name = cmp.Or(e.Name, a.name, e.Identity)
+			if a.joinedAt.IsZero() {
+				a.joinedAt = e.Time
+			}
+		case eventLeave:
+			if a, ok := byID[e.Identity]; ok && !a.joinedAt.IsZero() {
+				a.present += e.Time.Sub(a.joinedAt)
+				a.joinedAt = time.Time{}
+			}
+		case eventCommand:
+			commands[cmp.Or(e.Name, e.Identity)]++
+		case eventState:
+			if playing != nil {
+				playing.played += e.Time.Sub(since)
+				playing = nil
+			}
+			if e.Title != "" {
+				t, ok := byTitle[e.Title]
+				if !ok {
+					t = &watched{title: e.Title, started: e.Time}
+					byTitle[e.Title] = t
+					tapes = append(tapes, t)
+				}
+				if e.Status == caster.StatusPlaying {
+					playing, since = t, e.Time
+				}
+			}
+			switch e.Status {
+			case caster.StatusPaused:
+				pauses++
+			case caster.StatusSeeking, caster.StatusFwd, caster.StatusBack:
+				seeks++
+			}
+		}
+	}
+	if playing != nil {
+		playing.played += end.Sub(since)
+	}
+	for _, a := range people {
+		if !a.joinedAt.IsZero() {
+			a.present += end.Sub(a.joinedAt)
+		}
+	}
+
+	fmt.Fprintf(w, "Session %s in %s\n", session, room)
+	fmt.Fprintf(w, "  %s to %s (%s)", start.Local().Format(time.DateTime), end.Local().Format(time.TimeOnly), end.Sub(start).Round(time.Second))
+	if !ended {
+		fmt.Fprint(w, ", no end recorded")
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nWatched")
+	if len(tapes) == 0 {
+		fmt.Fprintln(tw, "  nothing")
+	}
+	for _, t := range tapes {
+		fmt.Fprintf(tw, "  %s\t%s\t%s played\n", t.started.Local().Format(time.TimeOnly), t.title, t.played.Round(time.Second))
+	}
+	fmt.Fprintln(tw, "\nAttended")
+	if len(people) == 0 {
+		fmt.Fprintln(tw, "  nobody")
+	}
+	for _, a := range people {
+		fmt.Fprintf(tw, "  %s\tfrom %s\t%s\n", a.name, a.joined.Local().Format(time.TimeOnly), a.present.Round(time.Second))
+	}
+	fmt.Fprintf(tw, "\nActivity\n  %d pauses, %d seeks\n", pauses, seeks)
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(commands[b], commands[a]), cmp.Compare(a, b))
+	})
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%d commands\n", name, commands[name])
+	}
+
+	fmt.Fprintln(tw, "\nTimeline")
+	for _, e := range events {
+		fmt.Fprintf(tw, "  %s\t%s\n", e.Time.Local().Format(time.TimeOnly), describeEvent(e))
+	}
+	tw.Flush()
+}
+
+func describeEvent(e roomEvent) string {
+	who := cmp.Or(e.Name, e.Identity)
+	switch e.Type {
+	case eventStart:
+		return "caster connected"
+	case eventEnd:
+		return "caster disconnected"
+	case eventJoin:
+		return who + " joined"
+	case eventLeave:
+		return who + " left"
+	case eventCommand:
+		return who + ": " + e.Command
+	case eventState:
+		status := string(e.Status)
+		if e.Status == caster.StatusPlaying {
+			status = "PLAYING"
+		}
+		if e.Title == "" {
+			return status
+		}
+		if e.Position != "" {
+			return fmt.Sprintf("%s %s at %s", status, e.Title, e.Position)
+		}
+		return fmt.Sprintf("%s %s", status, e.Title)
+	}
+	return e.Type
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/progrium/tapecafe/caster"
+)
+
+func TestDescribeEvent(t *testing.T) {
+	for _, tt := range []struct {
+		event roomEvent
+		want  string
+	}{
+		{roomEvent{Type: eventStart}, "caster connected"},
+		{roomEvent{Type: eventEnd}, "caster disconnected"},
+		{roomEvent{Type: eventJoin, Identity: "u1", Name: "Ada"}, "Ada joined"},
+		{roomEvent{Type: eventLeave, Identity: "u1"}, "u1 left"},
+		{roomEvent{Type: eventCommand, Identity: "api", Command: "/seek 1:00"}, "api: /seek 1:00"},
+		{roomEvent{Type: eventState, Status: caster.StatusPlaying, Title: "Tape"}, "PLAYING Tape"},
+		{roomEvent{Type: eventState, Status: caster.StatusPaused, Title: "Tape", Position: "00:01:00"}, string(caster.StatusPaused) + " Tape at 00:01:00"},
+		{roomEvent{Type: eventState, Status: caster.StatusReady}, string(caster.StatusReady)},
+		{roomEvent{Type: "other"}, "other"},
+	} {
+		if got := describeEvent(tt.event); got != tt.want {
+			t.Errorf("describeEvent(%+v) = %q, want %q", tt.event, got, tt.want)
+		}
+	}
+}
+
+func TestPrintReport(t *testing.T) {
+	at := func(min int) time.Time {
+		return time.Date(2024, 1, 1, 20, min, 0, 0, time.Local)
+	}
+	events := []roomEvent{
+		{Time: at(0), Type: eventStart},
+		{Time: at(1), Type: eventJoin, Identity: "u1", Name: "Ada"},
+		{Time: at(2), Type: eventState, Status: caster.StatusReady, Title: "Tape"},
+		{Time: at(3), Type: eventCommand, Identity: "u1", Name: "Ada", Command: "/play"},
+		{Time: at(3), Type: eventState, Status: caster.StatusPlaying, Title: "Tape"},
+		{Time: at(13), Type: eventState, Status: caster.StatusPaused, Title: "Tape"},
+		{Time: at(15), Type: eventState, Status: caster.StatusPlaying, Title: "Tape"},
+		{Time: at(20), Type: eventLeave, Identity: "u1"},
+		{Time: at(25), Type: eventEnd},
+	}
+	var b strings.Builder
+	printReport(&b, "lobby", "s1", events)
+	out := b.String()
+	for _, want := range []string{
+		"Session s1 in lobby\n",
+		"(25m0s)\n",
+		"Tape  20m0s played",
+		"Ada  from 20:01:00  19m0s",
+		"1 pauses, 0 seeks",
+		"Ada  1 commands",
+		"20:03:00  Ada: /play",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "no end recorded") {
+		t.Errorf("report of an ended session says no end recorded:\n%s", out)
+	}
+
+	b.Reset()
+	printReport(&b, "lobby", "s2", events[:4])
+	if !strings.Contains(b.String(), "no end recorded") {
+		t.Errorf("report of an unended session doesn't say so:\n%s", b.String())
+	}
+}
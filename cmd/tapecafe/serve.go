@@ -2,28 +2,29 @@ package main
 
 import (
 	"context"
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/livekit/protocol/auth"
 	lkp "github.com/livekit/protocol/livekit"
-	lksdk "github.com/livekit/server-sdk-go"
 	lksdk2 "github.com/livekit/server-sdk-go/v2"
 	"github.com/progrium/tapecafe/caster"
 	"github.com/progrium/tapecafe/server"
 	"github.com/progrium/tapecafe/ui"
 	"github.com/rs/xid"
-	"golang.ngrok.com/ngrok"
-	ngrokconfig "golang.ngrok.com/ngrok/config"
 	"golang.org/x/net/websocket"
 	"tractor.dev/toolkit-go/duplex/codec"
 	"tractor.dev/toolkit-go/duplex/mux"
@@ -32,45 +33,139 @@ import (
 	"tractor.dev/toolkit-go/engine/cli"
 )
 
+const (
+	lkAPIURL    = "http://localhost:7880"
+	lkAPIKey    = "devkey"
+	lkAPISecret = "secret"
+)
+
 var (
 	bindAddr string
 
 	lkURL string
 
-	stateListeners map[string]*sync.Map
+	stateListeners   map[string]*sync.Map
+	stateListenersMu sync.Mutex
+	lastStates       sync.Map
+	storyboards      sync.Map
 )
 
 func init() {
 	stateListeners = make(map[string]*sync.Map)
 }
 
+// roomListeners returns the state websocket connections of room.
+func roomListeners(room string) *sync.Map {
+	stateListenersMu.Lock()
+	defer stateListenersMu.Unlock()
+	listeners, ok := stateListeners[room]
+	if !ok {
+		listeners = &sync.Map{}
+		stateListeners[room] = listeners
+	}
+	return listeners
+}
+
 func serveCmd() *cli.Command {
 	cmd := &cli.Command{
 		Usage: "serve",
 		Run: func(ctx *cli.Context, args []string) {
+			if err := setupLogging(); err != nil {
+				fatal("serve", "err", err)
+			}
+
 			l, err := setupListener()
 			if err != nil {
-				log.Fatal("listen:", err)
+				fatal("listen", "err", err)
 			}
 			defer l.Close()
 
-			fmt.Println("Listening on:", publicURL(l))
+			slog.Info("listening", "url", publicURL(l))
+
+			if withLiveKit {
+				dir, err := livekitDir()
+				if err != nil {
+					fatal("livekit", "err", err)
+				}
+				lkCtx, stopLiveKit := context.WithCancel(context.Background())
+				sup, err := startLiveKit(lkCtx, dir)
+				// stop LiveKit after the ingresses are closed below
+				defer func() {
+					stopLiveKit()
+					sup.Wait()
+				}()
+				if err != nil {
+					stopLiveKit()
+					sup.Wait()
+					fatal("livekit", "err", err)
+				}
+			}
 
-			// if err := ensureIngress(); err != nil {
-			// 	log.Fatal("ensure ingress:", err)
-			// }
+			if err := reconcileIngresses(); err != nil {
+				slog.Error("reconcile ingresses", "err", err)
+			}
 
 			mux := http.NewServeMux()
 			mux.Handle("/-/cast/ingress", websocket.Handler(server.HandleIngress))
 			mux.Handle("/-/cast/rpc", websocket.Handler(serveRPC))
+			mux.Handle("/-/cast/whip/", http.HandlerFunc(server.ProxyWHIP))
 			mux.Handle("/-/state", websocket.Handler(handleState))
+			mux.Handle("/-/storyboard", http.HandlerFunc(handleStoryboard))
+			mux.Handle("/-/chat", http.HandlerFunc(handleChatHistory))
+			mux.Handle("/-/api/rooms/", http.HandlerFunc(handleRoomAPI))
+			mux.Handle("/-/api/admin/rooms", http.HandlerFunc(handleAdminRooms))
+			mux.Handle("/-/api/admin/rooms/", http.HandlerFunc(handleAdminRoomAction))
+			mux.Handle("/-/admin", http.HandlerFunc(handleAdminPage))
+			mux.Handle("/-/metrics", metricsHandler())
+			mux.Handle("/-/healthz", http.HandlerFunc(handleHealthz))
+			mux.Handle("/-/readyz", http.HandlerFunc(handleReadyz))
 			mux.Handle("/rtc", http.HandlerFunc(server.ProxyRTC))
 			mux.Handle("/", http.HandlerFunc(handleParticipate))
 
-			log.Fatal(http.Serve(l, corsMiddleware(mux)))
+			// canceling baseCtx ends the websocket handlers, which outlive
+			// Shutdown otherwise
+			baseCtx, cancelBase := context.WithCancel(context.Background())
+			defer cancelBase()
+			srv := &http.Server{
+				Handler:     corsMiddleware(mux),
+				BaseContext: func(net.Listener) context.Context { return baseCtx },
+			}
+			serveErr := make(chan error, 1)
+			go func() { serveErr <- srv.Serve(l) }()
+
+			sigChan := make(chan os.Signal, 1)
+			signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+			select {
+			case err := <-serveErr:
+				fatal("serve", "err", err)
+			case sig := <-sigChan:
+				slog.Info("shutting down", "signal", sig.String())
+			}
+			go func() {
+				<-sigChan
+				fatal("serve: forced shutdown")
+			}()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			notifyRooms(shutdownCtx)
+			cancelBase()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				slog.Error("shutdown", "err", err)
+			}
+			closeChallengeServer(shutdownCtx)
+			closeIngresses(shutdownCtx)
 		},
 	}
 	cmd.Flags().StringVar(&bindAddr, "bind", ":9091", "address to bind the server")
+	cmd.Flags().DurationVar(&ingressIdle, "ingress-idle", 5*time.Minute, "delete a room's ingress after its caster is gone this long")
+	cmd.Flags().BoolVar(&rotateIngress, "rotate-ingress-keys", false, "create a new ingress and stream key for every cast session")
+	cmd.Flags().StringVar(&apiToken, "api-token", os.Getenv("TAPECAFE_API_TOKEN"), "bearer token for the control API (disabled if empty)")
+	cmd.Flags().StringVar(&dataDir, "data-dir", defaultDataDir(), "directory to keep chat transcripts in")
+	cmd.Flags().BoolVar(&withLiveKit, "with-livekit", false, "run and supervise redis, livekit-server and ingress from the PATH")
+	listenerFlags(cmd)
+	tlsFlags(cmd)
+	logFlags(cmd)
 	return cmd
 }
 
@@ -96,75 +191,198 @@ func corsMiddleware(next http.Handler) http.Handler {
 func handleState(conn *websocket.Conn) {
 	room := conn.Request().URL.Query().Get("room")
 	if room == "" {
-		log.Println("No room provided")
+		slog.Warn("state connection without room")
 		conn.Close()
 		return
 	}
-	log.Println("New state connection for room:", room)
-	_, ok := stateListeners[room]
+	slog.Debug("state connection", "room", room, "remote", conn.Request().RemoteAddr)
+	listeners := roomListeners(room)
+	listeners.Store(conn, true)
+	<-conn.Request().Context().Done()
+	listeners.Delete(conn)
+}
+
+// broadcastState sends state to the room's state subscribers, dropping any
+// that can't be written to.
+func broadcastState(room string, state caster.SharedState) {
+	msg, err := json.Marshal(state)
+	if err != nil {
+		slog.Error("marshal state", "room", room, "err", err)
+		return
+	}
+	listeners := roomListeners(room)
+	listeners.Range(func(key, value any) bool {
+		if conn, ok := key.(*websocket.Conn); ok {
+			_, err := conn.Write(msg)
+			if err != nil {
+				listeners.Delete(conn)
+				slog.Debug("state subscriber gone", "room", room, "err", err)
+			}
+		}
+		return true
+	})
+}
+
+func handleStoryboard(w http.ResponseWriter, r *http.Request) {
+	image, ok := storyboards.Load(r.URL.Query().Get("room"))
 	if !ok {
-		stateListeners[room] = &sync.Map{}
+		http.NotFound(w, r)
+		return
 	}
-	stateListeners[room].Store(conn, true)
-	<-conn.Request().Context().Done()
-	stateListeners[room].Delete(conn)
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(image.([]byte))
 }
 
 func serveRPC(conn *websocket.Conn) {
 	room := conn.Request().URL.Query().Get("room")
 	if room == "" {
-		log.Println("No room provided")
+		slog.Warn("rpc connection without room")
 		conn.Close()
 		return
 	}
-	log.Println("New RPC connection for room:", room)
+	// older casters don't send a session ID
+	session := conn.Request().URL.Query().Get("session")
+	if _, err := xid.FromString(session); err != nil {
+		session = xid.New().String()
+	}
+	logger := slog.With("room", room, "session", session)
+	logger.Info("caster connected", "remote", conn.Request().RemoteAddr)
+	defer logger.Info("caster disconnected")
 	conn.PayloadType = websocket.BinaryFrame
 	defer conn.Close()
 	peer := talk.NewPeer(mux.New(conn), codec.CBORCodec{})
+	cc := &casterConn{
+		Peer:        peer,
+		RemoteAddr:  conn.Request().RemoteAddr,
+		ConnectedAt: time.Now(),
+		chat:        make(chan string),
+	}
+	// ends with the caster's connection, or the server shutting down
+	ctx, cancel := context.WithCancel(conn.Request().Context())
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { peer.Close() })
+	defer stop()
+	chat := roomChatLog(room)
+	if err := chat.start(session); err != nil {
+		logger.Error("chat log", "err", err)
+	}
+	defer chat.end(session)
+	events := roomEventLog(room)
+	if err := events.start(session); err != nil {
+		logger.Error("event log", "err", err)
+	}
+	defer events.end(session)
+	casters.Store(room, cc)
+	rpcConnections.Inc()
+	defer rpcConnections.Dec()
+	defer func() {
+		casters.CompareAndDelete(room, cc)
+		if _, ok := casters.Load(room); !ok {
+			releaseIngress(room)
+			storyboards.Delete(room)
+			lastStates.Delete(room)
+		}
+	}()
 	peer.Handle("cast.ingress", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
-		ingressKey, err := ensureIngress(room)
+		var protocol string
+		c.Receive(&protocol)
+		inputType := lkp.IngressInput_RTMP_INPUT
+		if protocol == caster.ProtocolWHIP {
+			inputType = lkp.IngressInput_WHIP_INPUT
+		}
+		ingressKey, err := ensureIngress(room, inputType)
 		if err != nil {
 			r.Return(err)
 			return
 		}
+		if inputType == lkp.IngressInput_WHIP_INPUT {
+			r.Return(fmt.Sprintf("/-/cast/whip/%s", ingressKey))
+			return
+		}
 		r.Return(fmt.Sprintf("/live/%s", ingressKey))
 	}))
+	peer.Handle("cast.token", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		// publishing directly as the caster would collide with an ingress
+		if err := deleteIngress(context.TODO(), room); err != nil {
+			logger.Error("delete ingress", "err", err)
+		}
+		at := auth.NewAccessToken(lkAPIKey, lkAPISecret)
+		grant := &auth.VideoGrant{
+			RoomJoin: true,
+			Room:     room,
+		}
+		grant.SetCanPublish(true)
+		grant.SetCanSubscribe(false)
+		at.AddGrant(grant).
+			SetIdentity(ingressIdentity).
+			SetValidFor(24 * time.Hour)
+		token, err := at.ToJWT()
+		if err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return(token)
+	}))
+	peer.Handle("cast.say", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var msg string
+		if err := c.Receive(&msg); err != nil {
+			r.Return(err)
+			return
+		}
+		sayCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := cc.say(sayCtx, msg); err != nil {
+			r.Return(err)
+			return
+		}
+		r.Return()
+	}))
 	peer.Handle("cast.state", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
 		var state caster.SharedState
 		if err := c.Receive(&state); err != nil {
-			log.Println("state:", err)
+			logger.Error("receive state", "err", err)
 			return
 		}
-		msg, err := json.Marshal(state)
-		if err != nil {
-			log.Println("state:", err)
+		lastStates.Store(room, state)
+		events.state(state)
+		broadcastState(room, state)
+	}))
+	// the caster reports the chat commands it ran, so the ones it rejected
+	// aren't logged
+	peer.Handle("cast.command", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var cmd caster.ChatCommand
+		if err := c.Receive(&cmd); err != nil {
+			r.Return(err)
 			return
 		}
-		_, ok := stateListeners[room]
-		if !ok {
-			stateListeners[room] = &sync.Map{}
-		}
-		stateListeners[room].Range(func(key, value any) bool {
-			if conn, ok := key.(*websocket.Conn); ok {
-				_, err := conn.Write(msg)
-				if err != nil {
-					stateListeners[room].Delete(conn)
-					log.Println("state:", err)
-				}
-			}
-			return true
+		events.record(roomEvent{
+			Type:     eventCommand,
+			Identity: cmd.Identity,
+			Name:     cmd.Name,
+			Command:  cmd.Command,
 		})
+		r.Return()
+	}))
+	peer.Handle("cast.storyboard", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
+		var image []byte
+		if err := c.Receive(&image); err != nil {
+			r.Return(err)
+			return
+		}
+		storyboards.Store(room, image)
+		sum := sha1.Sum(image)
+		r.Return(fmt.Sprintf("/-/storyboard?room=%s&v=%x", url.QueryEscape(room), sum[:4]))
 	}))
 	peer.Handle("cast.chat", rpc.HandlerFunc(func(r rpc.Responder, c *rpc.Call) {
 		_, err := r.Continue()
 		if err != nil {
-			log.Println("chat:", err)
+			logger.Error("chat", "err", err)
 		}
-		done := make(chan struct{})
-		chat := make(chan string)
-		room, err := lksdk2.ConnectToRoom("http://localhost:7880", lksdk2.ConnectInfo{
-			APIKey:              "devkey",
-			APISecret:           "secret",
+		done := make(chan struct{}, 1)
+		room, err := lksdk2.ConnectToRoom(lkAPIURL, lksdk2.ConnectInfo{
+			APIKey:              lkAPIKey,
+			APISecret:           lkAPISecret,
 			RoomName:            room,
 			ParticipantIdentity: "chatbot",
 		}, &lksdk2.RoomCallback{
@@ -173,46 +391,85 @@ func serveRPC(conn *websocket.Conn) {
 					m := make(map[string]any)
 					err := json.Unmarshal(data.ToProto().Value.(*lkp.DataPacket_User).User.Payload, &m)
 					if err != nil {
-						log.Println("chat:", err)
+						logger.Warn("chat decode", "participant", params.SenderIdentity, "err", err)
 						return
 					}
+					m["participant"] = params.SenderIdentity
+					m["participantName"] = displayName(params.Sender)
+					chatMessages.Inc()
+					if msg, ok := m["message"].(string); ok {
+						id, _ := m["id"].(string)
+						ts, _ := m["timestamp"].(float64)
+						chat.add(chatEntry{
+							ID:        id,
+							Timestamp: int64(ts),
+							Identity:  params.SenderIdentity,
+							Name:      displayName(params.Sender),
+							Message:   msg,
+						})
+					}
+					if msg, ok := m["message"].(string); ok && strings.HasPrefix(msg, "/") {
+						countCommand(strings.Fields(msg)[0], "chat")
+					}
 					if err := r.Send(m); err != nil {
-						log.Println("chat:", err)
+						logger.Error("chat forward", "err", err)
 						return
 					}
 				},
 			},
+			OnParticipantConnected: func(p *lksdk2.RemoteParticipant) {
+				recordPresence(events, eventJoin, p)
+			},
+			OnParticipantDisconnected: func(p *lksdk2.RemoteParticipant) {
+				recordPresence(events, eventLeave, p)
+			},
 			OnDisconnected: func() {
-				done <- struct{}{}
+				select {
+				case done <- struct{}{}:
+				default:
+				}
 			},
 		})
 		if err != nil {
-			log.Println("chat:", err)
+			logger.Error("chat connect", "err", err)
 			return
 		}
+		// the callbacks only see participants joining from now on
+		for _, p := range room.GetRemoteParticipants() {
+			recordPresence(events, eventJoin, p)
+		}
 		for {
 			select {
 			case <-done:
 				return
-			case msg := <-chat:
+			case <-ctx.Done():
+				room.Disconnect()
+				return
+			case msg := <-cc.chat:
+				entry := chatEntry{
+					ID:        uuid.NewString(),
+					Timestamp: time.Now().UnixMilli(),
+					Identity:  "chatbot",
+					Message:   msg,
+				}
 				msgBytes, err := json.Marshal(map[string]any{
-					"id":        uuid.NewString(),
-					"message":   msg,
-					"timestamp": time.Now().UnixMilli(),
+					"id":        entry.ID,
+					"message":   entry.Message,
+					"timestamp": entry.Timestamp,
 				})
 				if err != nil {
-					log.Println("chat marshal:", err)
+					logger.Error("chat marshal", "err", err)
 					return
 				}
+				chat.add(entry)
 				dp := lksdk2.UserData(msgBytes)
 				dp.Topic = "lk-chat-topic"
 				if err := room.LocalParticipant.PublishDataPacket(dp,
 					lksdk2.WithDataPublishReliable(true),
 					lksdk2.WithDataPublishTopic("lk-chat-topic"),
 				); err != nil {
-					log.Println("chat publish:", err)
+					logger.Error("chat publish", "err", err)
 				}
-			default:
 			}
 		}
 	}))
@@ -222,7 +479,7 @@ func serveRPC(conn *websocket.Conn) {
 func handleParticipate(w http.ResponseWriter, r *http.Request) {
 	sub, err := fs.Sub(ui.Dir, "dist")
 	if err != nil {
-		log.Print(err)
+		slog.Error("ui assets", "err", err)
 		return
 	}
 
@@ -234,7 +491,7 @@ func handleParticipate(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Query().Get("token") == "" {
 		room := strings.TrimPrefix(r.URL.Path, "/")
 		md := true
-		at := auth.NewAccessToken("devkey", "secret")
+		at := auth.NewAccessToken(lkAPIKey, lkAPISecret)
 		grant := &auth.VideoGrant{
 			RoomJoin:             true,
 			Room:                 room,
@@ -246,7 +503,7 @@ func handleParticipate(w http.ResponseWriter, r *http.Request) {
 
 		token, err := at.ToJWT()
 		if err != nil {
-			log.Println(err)
+			slog.Error("participant token", "room", room, "err", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -266,64 +523,23 @@ func publicURL(l net.Listener) string {
 	if url := os.Getenv("PUBLIC_URL"); url != "" {
 		return url
 	}
-	if tun, ok := l.(ngrok.Tunnel); ok {
-		return tun.URL()
+	if l, ok := l.(interface{ URL() string }); ok {
+		return l.URL()
 	}
 	hostname := strings.ReplaceAll(l.Addr().String(), "0.0.0.0", "localhost")
 	return fmt.Sprintf("http://%s", hostname)
 }
 
-func setupListener() (l net.Listener, err error) {
-	token := os.Getenv("NGROK_TOKEN")
-	if token != "" && os.Getenv("PUBLIC_URL") == "" {
-		l, err = ngrok.Listen(context.Background(),
-			ngrokconfig.HTTPEndpoint(),
-			ngrok.WithAuthtoken(token),
-		)
-		if err == nil {
-			lkURL = strings.Replace(publicURL(l), "https:", "wss:", 1)
-		}
-	} else {
-		l, err = net.Listen("tcp4", bindAddr)
-		if err == nil {
-			lkURL = strings.Replace(publicURL(l), "https:", "wss:", 1)
-			lkURL = strings.Replace(lkURL, "http:", "ws:", 1)
-		}
-	}
-	return
-}
-
-func ensureIngress(room string) (string, error) {
-	ingressClient := lksdk.NewIngressClient("ws://localhost:7880", "devkey", "secret")
-
-	ctx := context.TODO()
-	lki, err := ingressClient.ListIngress(ctx, &lkp.ListIngressRequest{})
+func setupListener() (net.Listener, error) {
+	name, err := listenerProvider()
 	if err != nil {
-		return "", err
-	}
-
-	found := false
-	var ingress *lkp.IngressInfo
-	for _, i := range lki.GetItems() {
-		if i.RoomName == room {
-			found = true
-			ingress = i
-			break
-		}
+		return nil, err
 	}
-	if !found {
-		ingress, err = ingressClient.CreateIngress(ctx, &lkp.CreateIngressRequest{
-			InputType:           0,
-			Name:                room + "-ingress",
-			RoomName:            room,
-			ParticipantIdentity: "caster",
-		})
-		if err != nil {
-			return "", err
-		}
+	l, err := listenerProviders[name](context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
-	log.Println("INGRESS URL:", ingress.GetUrl())
-	log.Println("INGRESS KEY:", ingress.GetStreamKey())
-
-	return ingress.GetStreamKey(), nil
+	lkURL = strings.Replace(publicURL(l), "https:", "wss:", 1)
+	lkURL = strings.Replace(lkURL, "http:", "ws:", 1)
+	return l, nil
 }
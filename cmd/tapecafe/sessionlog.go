@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultDataDir keeps serve's data next to the caster's resume state in the
+// user cache dir, which the docker command mounts as a volume.
+func defaultDataDir() string {
+	if dir := os.Getenv("TAPECAFE_DATA_DIR"); dir != "" {
+		return dir
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return ".tapecafe"
+	}
+	return filepath.Join(cache, "tapecafe")
+}
+
+// roomDataDir returns the directory for a kind of per-room data, escaping
+// the room name so it can't reach outside of it.
+func roomDataDir(kind, room string) string {
+	return filepath.Join(dataDir, kind, strings.ReplaceAll(url.PathEscape(room), ".", "%2E"))
+}
+
+// sessionLog appends JSON lines to a file per cast session in dir. Session
+// IDs are xids, so the files sort in the order the sessions started.
+type sessionLog struct {
+	dir string
+
+	mu      sync.Mutex
+	session string
+	file    *os.File
+}
+
+// start starts the session's file, ending the previous session's.
+func (l *sessionLog) start(session string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(l.dir, session+".jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	l.session = session
+	l.file = f
+	return nil
+}
+
+// end closes the session's file, unless another session has started since.
+func (l *sessionLog) end(session string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.session != session || l.file == nil {
+		return
+	}
+	l.file.Close()
+	l.file = nil
+}
+
+// current returns the session whose file is open, if any.
+func (l *sessionLog) current() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return ""
+	}
+	return l.session
+}
+
+// append writes v to the current session's file, if there is one.
+func (l *sessionLog) append(v any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(b, '\n'))
+	return err
+}
+
+// logSessions lists the sessions with files in dir, oldest first.
+func logSessions(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []string
+	for _, f := range files {
+		sessions = append(sessions, strings.TrimSuffix(filepath.Base(f), ".jsonl"))
+	}
+	slices.Sort(sessions)
+	return sessions, nil
+}
+
+// readSessionLog reads the lines of a session's file in dir.
+func readSessionLog[T any](dir, session string) ([]T, error) {
+	f, err := os.Open(filepath.Join(dir, session+".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var v T
+		// skip a line cut short by a crash
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			continue
+		}
+		lines = append(lines, v)
+	}
+	return lines, scanner.Err()
+}
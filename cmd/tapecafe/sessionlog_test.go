@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRoomDataDir(t *testing.T) {
+	dataDir = "/data"
+	for _, tt := range []struct {
+		room, want string
+	}{
+		{"lobby", "/data/chat/lobby"},
+		{"movie night", "/data/chat/movie%20night"},
+		{"../etc", "/data/chat/%2E%2E%2Fetc"},
+		{"..", "/data/chat/%2E%2E"},
+		{"a/b", "/data/chat/a%2Fb"},
+		{`a\b`, "/data/chat/a%5Cb"},
+	} {
+		if got := roomDataDir("chat", tt.room); got != filepath.FromSlash(tt.want) {
+			t.Errorf("roomDataDir(%q) = %q, want %q", tt.room, got, tt.want)
+		}
+	}
+}
+
+func TestReadSessionLog(t *testing.T) {
+	for _, tt := range []struct {
+		name, file string
+		want       []string
+	}{
+		{"empty", "", nil},
+		{"lines", `{"message":"a"}` + "\n" + `{"message":"b"}` + "\n", []string{"a", "b"}},
+		{"cut short", `{"message":"a"}` + "\n" + `{"mess`, []string{"a"}},
+		{"bad line", `{"message":"a"}` + "\nnot json\n" + `{"message":"b"}` + "\n", []string{"a", "b"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "s1.jsonl"), []byte(tt.file), 0644); err != nil {
+				t.Fatal(err)
+			}
+			entries, err := readSessionLog[chatEntry](dir, "s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Message)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatHistoryAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	c := &chatLog{sessionLog: sessionLog{dir: dir}}
+	if err := c.start("s1"); err != nil {
+		t.Fatal(err)
+	}
+	c.add(chatEntry{ID: "1", Message: "hello"})
+	c.end("s1")
+	c.start("s2") // no chat in this session
+	c.end("s2")
+
+	// a new server starting the next session
+	c = &chatLog{sessionLog: sessionLog{dir: dir}}
+	if err := c.start("s3"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.end("s3")
+	history := c.history()
+	if len(history) != 1 || history[0].Message != "hello" {
+		t.Fatalf("history = %+v, want the message from s1", history)
+	}
+	c.add(chatEntry{ID: "2", Message: "again"})
+	if got := c.history(); len(got) != 2 || !strings.Contains(got[1].Message, "again") {
+		t.Fatalf("history = %+v", got)
+	}
+}
+
+func TestChatHistoryUnknownRoom(t *testing.T) {
+	dataDir = t.TempDir()
+	w := httptest.NewRecorder()
+	handleChatHistory(w, httptest.NewRequest("GET", "/-/chat?room=nobody", nil))
+	if got := strings.TrimSpace(w.Body.String()); got != "[]" {
+		t.Errorf("history = %s, want []", got)
+	}
+	if _, ok := chatLogs.Load("nobody"); ok {
+		t.Error("history of an unknown room added a chat log")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/progrium/tapecafe/caster"
+)
+
+const (
+	// shutdownTimeout bounds how long serve and cast take to shut down cleanly.
+	shutdownTimeout = 10 * time.Second
+	// noticeTimeout bounds posting the shutdown notice to each room, so a
+	// stuck caster doesn't hold up the others or the shutdown.
+	noticeTimeout = 2 * time.Second
+)
+
+// notifyRooms tells every room the server is going away, posting a chat
+// notice through each caster's chat bot and a final eject state.
+func notifyRooms(ctx context.Context) {
+	var wg sync.WaitGroup
+	casters.Range(func(key, value any) bool {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, noticeTimeout)
+			defer cancel()
+			if err := value.(*casterConn).say(ctx, "⏏ The server is shutting down."); err != nil {
+				slog.Warn("chat notice", "room", key, "err", err)
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+	lastStates.Range(func(key, value any) bool {
+		state := value.(caster.SharedState)
+		state.Status = caster.StatusFinished
+		state.Health = nil
+		broadcastState(key.(string), state)
+		return true
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+	"tractor.dev/toolkit-go/engine/cli"
+)
+
+var (
+	tlsCert string
+	tlsKey  string
+
+	autocertDomains string
+	autocertEmail   string
+	autocertCache   string
+	autocertHTTP    string
+
+	// challengeServer answers HTTP-01 challenges in autocert mode
+	challengeServer *http.Server
+)
+
+func tlsFlags(cmd *cli.Command) {
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file to serve https with")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS key file to serve https with")
+	cmd.Flags().StringVar(&autocertDomains, "autocert", "", "comma-separated domains to get Let's Encrypt certificates for")
+	cmd.Flags().StringVar(&autocertEmail, "autocert-email", "", "contact email for the ACME account")
+	cmd.Flags().StringVar(&autocertCache, "autocert-cache", "", "directory to cache certificates in (default is the user cache dir)")
+	cmd.Flags().StringVar(&autocertHTTP, "autocert-http", ":80", "address to answer HTTP-01 challenges and redirect to https on")
+}
+
+// tlsEnabled reports whether serve was asked to serve https itself.
+func tlsEnabled() bool {
+	return tlsCert != "" || tlsKey != "" || autocertDomains != ""
+}
+
+// autocertHosts returns the domains of --autocert.
+func autocertHosts() []string {
+	var hosts []string
+	for _, host := range strings.Split(autocertDomains, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// setupTLS returns the TLS config for serve. In autocert mode it also starts
+// answering HTTP-01 challenges on autocertHTTP, redirecting everything else
+// to https.
+func setupTLS() (*tls.Config, error) {
+	if (tlsCert != "" || tlsKey != "") && autocertDomains != "" {
+		return nil, errors.New("--tls-cert and --autocert can't be used together")
+	}
+	if tlsCert != "" || tlsKey != "" {
+		if tlsCert == "" {
+			return nil, errors.New("--tls-key needs --tls-cert")
+		}
+		if tlsKey == "" {
+			return nil, errors.New("--tls-cert needs --tls-key")
+		}
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			// the websocket handlers hijack HTTP/1.1 connections
+			NextProtos: []string{"http/1.1"},
+		}, nil
+	}
+
+	if autocertCache == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		autocertCache = filepath.Join(cache, "tapecafe", "autocert")
+	}
+	hosts := autocertHosts()
+	if len(hosts) == 0 {
+		return nil, errors.New("--autocert needs a domain")
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Cache:      autocert.DirCache(autocertCache),
+		Email:      autocertEmail,
+	}
+	l, err := net.Listen("tcp", autocertHTTP)
+	if err != nil {
+		return nil, err
+	}
+	challengeServer = &http.Server{Handler: m.HTTPHandler(nil)}
+	go func() {
+		if err := challengeServer.Serve(l); err != nil && err != http.ErrServerClosed {
+			slog.Error("autocert http", "err", err)
+		}
+	}()
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"http/1.1", acme.ALPNProto},
+	}, nil
+}
+
+// tlsHost returns the host to put in the public URL in autocert mode, with
+// the port unless it is the default.
+func tlsHost(addr net.Addr) string {
+	host := autocertHosts()[0]
+	_, port, _ := net.SplitHostPort(addr.String())
+	if port == "443" {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// closeChallengeServer stops answering HTTP-01 challenges.
+func closeChallengeServer(ctx context.Context) {
+	if challengeServer == nil {
+		return
+	}
+	if err := challengeServer.Shutdown(ctx); err != nil {
+		slog.Error("autocert http", "err", err)
+	}
+}
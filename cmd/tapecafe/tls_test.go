@@ -0,0 +1,37 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetupTLSFlags(t *testing.T) {
+	for _, tt := range []struct {
+		name, cert, key, domains string
+	}{
+		{name: "key without cert", key: "key.pem"},
+		{name: "cert without key", cert: "cert.pem"},
+		{name: "cert and autocert", cert: "cert.pem", key: "key.pem", domains: "example.com"},
+		{name: "key and autocert", key: "key.pem", domains: "example.com"},
+		{name: "autocert without domains", domains: " , "},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsCert, tlsKey, autocertDomains = tt.cert, tt.key, tt.domains
+			defer func() { tlsCert, tlsKey, autocertDomains = "", "", "" }()
+			if !tlsEnabled() {
+				t.Fatal("TLS not enabled")
+			}
+			if _, err := setupTLS(); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestAutocertHosts(t *testing.T) {
+	autocertDomains = " example.com, www.example.com ,,"
+	defer func() { autocertDomains = "" }()
+	if got, want := autocertHosts(), []string{"example.com", "www.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("autocertHosts() = %q, want %q", got, want)
+	}
+}
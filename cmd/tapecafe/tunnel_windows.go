@@ -0,0 +1,20 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+func tunnelProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// killTunnel kills the tunnel command's process tree, since killing cmd.exe
+// leaves the processes it started running.
+func killTunnel(p *os.Process) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(p.Pid)).Run(); err != nil {
+		p.Kill()
+	}
+}
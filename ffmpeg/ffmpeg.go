@@ -2,10 +2,17 @@ package ffmpeg
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 )
@@ -14,7 +21,105 @@ type Runner struct {
 	Process *exec.Cmd
 	Run     int
 	Updates chan Update
+	Options Options
 	sync.Mutex
+
+	slating bool
+}
+
+// Options are applied to every stream started by a Runner.
+type Options struct {
+	// Normalize is the name of a loudness normalization filter, see NormalizeFilters.
+	Normalize string
+	// GainDb adjusts the audio volume in decibels.
+	GainDb float64
+	// OSD burns a VCR-style status overlay into the video when set.
+	OSD *OSD
+	// Slate is streamed by StartSlate while no content is playing.
+	Slate *Slate
+	// FastSeek lands seeks on the nearest keyframe instead of decoding up
+	// to the exact position.
+	FastSeek bool
+	// Logger receives ffmpeg's warnings and errors, slog.Default() if nil.
+	Logger *slog.Logger
+}
+
+func (o Options) logger() *slog.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return slog.Default()
+}
+
+// Slate is a generated title card with live updating text, drawn over a
+// black background or an optional still image or looping video.
+type Slate struct {
+	Font  string
+	Image string
+}
+
+var imageExts = []string{".png", ".jpg", ".jpeg", ".bmp", ".webp"}
+
+func (sl *Slate) inputArgs() []string {
+	if sl.Image == "" {
+		return []string{"-f", "lavfi", "-i", "color=c=black:s=1280x720:r=30"}
+	}
+	if slices.Contains(imageExts, strings.ToLower(filepath.Ext(sl.Image))) {
+		return []string{"-loop", "1", "-framerate", "30", "-i", sl.Image}
+	}
+	return []string{"-stream_loop", "-1", "-i", sl.Image}
+}
+
+func (sl *Slate) videoFilter(textfile string) string {
+	return fmt.Sprintf("scale=1280:720:force_original_aspect_ratio=decrease,pad=1280:720:(ow-iw)/2:(oh-ih)/2,format=yuv420p,"+
+		"drawtext=fontfile=%s:textfile=%s:reload=1:fontsize=h/12:fontcolor=white:shadowcolor=black:shadowx=3:shadowy=3:line_spacing=16:x=(w-text_w)/2:y=(h-text_h)/2",
+		escapeFilterValue(sl.Font), escapeFilterValue(textfile))
+}
+
+// OSD is drawn over the first seconds of a stream, showing the status,
+// the running position and the title.
+type OSD struct {
+	Font    string
+	Status  string
+	Title   string
+	Seconds int
+}
+
+func (o *OSD) videoFilter(seekMs int) (string, error) {
+	text := fmt.Sprintf("%s\n%%{pts:gmtime:%d:%%H\\:%%M\\:%%S}\n%s",
+		escapeText(o.Status), seekMs/1000, escapeText(o.Title))
+	textfile := filepath.Join(os.TempDir(), fmt.Sprintf("tapecafe-osd-%d.txt", os.Getpid()))
+	if err := os.WriteFile(textfile, []byte(text), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("drawtext=fontfile=%s:textfile=%s:fontsize=h/16:fontcolor=white:shadowcolor=black:shadowx=3:shadowy=3:line_spacing=12:x=w/16:y=h/12:enable=lt(t\\,%d)",
+		escapeFilterValue(o.Font), escapeFilterValue(textfile), o.Seconds), nil
+}
+
+// escapeText escapes drawtext expansion characters.
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`).Replace(s)
+}
+
+// escapeFilterValue escapes a filter option value for use in a filtergraph.
+func escapeFilterValue(s string) string {
+	return strings.NewReplacer(`\`, `\\\\`, "'", `\\\'`, ":", `\\:`).Replace(s)
+}
+
+var NormalizeFilters = map[string]string{
+	"loudnorm":   "loudnorm=I=-16:TP=-1.5:LRA=11",
+	"dynaudnorm": "dynaudnorm",
+}
+
+func (o Options) audioFilter() string {
+	var filters []string
+	if f, ok := NormalizeFilters[o.Normalize]; ok {
+		filters = append(filters, f)
+	}
+	if o.GainDb != 0 {
+		filters = append(filters, fmt.Sprintf("volume=%.1fdB", o.GainDb))
+	}
+	return strings.Join(filters, ",")
 }
 
 func NewRunner() *Runner {
@@ -29,10 +134,37 @@ type Update struct {
 	Progress Progress
 }
 
-type Progress map[string]string
+// Shutdown stops ffmpeg, letting it finish its output first, and waits for
+// it to exit. It is killed if it hasn't exited once ctx is done.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.Lock()
+	defer r.Unlock()
+	if r.Process == nil {
+		return nil
+	}
+	cmd := r.Process
+	r.Process = nil
+	r.slating = false
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-exited
+		return ctx.Err()
+	}
+}
 
-func (r *Runner) Shutdown() error {
-	return r.Process.Process.Kill()
+// kill kills cmd and reaps it in the background.
+func kill(cmd *exec.Cmd) error {
+	err := cmd.Process.Kill()
+	go cmd.Wait()
+	return err
 }
 
 func (r *Runner) Stop() error {
@@ -41,53 +173,163 @@ func (r *Runner) Stop() error {
 	if r.Process == nil {
 		return nil
 	}
-	err := r.Process.Process.Kill()
+	err := kill(r.Process)
 	r.Process = nil
+	r.slating = false
 	return err
 }
 
-func (r *Runner) Start(filename string, seekMs int, output string) error {
+// StartSlate streams the slate with text to output, or only updates the text
+// if the slate is already streaming.
+func (r *Runner) StartSlate(text, output string) error {
 	r.Lock()
 	defer r.Unlock()
-	cmd, err := StreamFile(filename, seekMs, output, r.Run, r.Updates)
+	if r.Options.Slate == nil {
+		return fmt.Errorf("no slate configured")
+	}
+	textfile := filepath.Join(os.TempDir(), fmt.Sprintf("tapecafe-slate-%d.txt", os.Getpid()))
+	// drawtext reloads the file every frame, so replace it atomically
+	tmp := textfile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(escapeText(text)), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, textfile); err != nil {
+		return err
+	}
+	if r.slating && r.Process != nil {
+		return nil
+	}
+	cmd, err := StreamSlate(r.Options.Slate, textfile, output, r.Options.logger())
 	if err != nil {
 		return err
 	}
 	if r.Process != nil {
-		if err := r.Process.Process.Kill(); err != nil {
+		if err := kill(r.Process); err != nil {
 			return err
 		}
 	}
 	r.Process = cmd
+	r.slating = true
 	r.Run++
 	return nil
 }
 
-func StreamFile(filename string, seekMs int, output string, run int, updates chan Update) (*exec.Cmd, error) {
-	fmt.Println("STREAMING:", filename, FormatTimeMs(seekMs))
-	cmd := exec.Command("ffmpeg",
+// StartCountdown streams a countdown leader of seconds to output.
+func (r *Runner) StartCountdown(seconds int, font, output string) error {
+	r.Lock()
+	defer r.Unlock()
+	cmd, err := StreamCountdown(seconds, font, output, r.Options.logger())
+	if err != nil {
+		return err
+	}
+	if r.Process != nil {
+		if err := kill(r.Process); err != nil {
+			return err
+		}
+	}
+	r.Process = cmd
+	r.slating = false
+	r.Run++
+	return nil
+}
+
+// Start streams filename from seekMs to output and returns the position the
+// stream actually starts at.
+func (r *Runner) Start(filename string, seekMs int, output string) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+	cmd, landedMs, err := StreamFile(filename, seekMs, output, r.Options, r.Run, r.Updates)
+	if err != nil {
+		return 0, err
+	}
+	if r.Process != nil {
+		if err := kill(r.Process); err != nil {
+			return 0, err
+		}
+	}
+	r.Process = cmd
+	r.slating = false
+	r.Run++
+	return landedMs, nil
+}
+
+func StreamSlate(slate *Slate, textfile, output string, logger *slog.Logger) (*exec.Cmd, error) {
+	logger.Info("streaming slate", "output", output)
+	args := []string{"-nostats", "-loglevel", "warning", "-re"}
+	args = append(args, slate.inputArgs()...)
+	args = append(args,
+		"-f", "lavfi", "-i", "anullsrc=r=44100:cl=stereo",
+		"-vf", slate.videoFilter(textfile),
+		"-map", "0:v", "-map", "1:a",
+		"-g", "60")
+	args = append(args, outputArgs(output, "1M", "64k")...)
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = &logWriter{logger: logger}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// StreamCountdown streams a film-style countdown leader with a beep every second.
+func StreamCountdown(seconds int, font, output string, logger *slog.Logger) (*exec.Cmd, error) {
+	logger.Info("streaming countdown", "seconds", seconds, "output", output)
+	textfile := filepath.Join(os.TempDir(), fmt.Sprintf("tapecafe-countdown-%d.txt", os.Getpid()))
+	if err := os.WriteFile(textfile, []byte(fmt.Sprintf("%%{eif:ceil(%d-t):d}", seconds)), 0644); err != nil {
+		return nil, err
+	}
+	args := []string{
 		"-nostats",
-		"-progress", "pipe:1",
-		"-loglevel", "quiet",
+		"-loglevel", "warning",
 		"-re",
-		"-ss", FormatTimeMs(seekMs),
-		"-i", filename,
-		"-c:v", "libx264",
-		"-c:a", "aac",
-		"-b:a", "160k",
-		"-b:v", "3M",
-		"-preset", "veryfast",
-		"-f", "flv",
-		output)
-	cmd.Stderr = os.Stderr
+		"-f", "lavfi", "-i", fmt.Sprintf("color=c=0x303030:s=1280x720:r=30:d=%d", seconds),
+		"-f", "lavfi", "-i", fmt.Sprintf("sine=f=1000:d=%d", seconds),
+		"-vf", "drawbox=x=0:y=ih/2-1:w=iw:h=2:color=white@0.5:t=fill," +
+			"drawbox=x=iw/2-1:y=0:w=2:h=ih:color=white@0.5:t=fill," +
+			fmt.Sprintf("drawtext=fontfile=%s:textfile=%s:fontsize=h/2:fontcolor=white:x=(w-text_w)/2:y=(h-text_h)/2",
+				escapeFilterValue(font), escapeFilterValue(textfile)),
+		"-af", `volume=volume=0:enable=gte(mod(t\,1)\,0.1)`,
+		"-g", "30",
+	}
+	args = append(args, outputArgs(output, "1M", "64k")...)
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = &logWriter{logger: logger}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
 
-	stdout, err := cmd.StdoutPipe()
+// StreamFile streams filename to output starting at seekMs. With a cached
+// keyframe index, it seeks the input to the nearest keyframe and decodes up
+// to seekMs, unless opts.FastSeek, returning the position actually landed on.
+func StreamFile(filename string, seekMs int, output string, opts Options, run int, updates chan Update) (*exec.Cmd, int, error) {
+	inputMs, outputMs := seekMs, 0
+	if index := CachedKeyframeIndex(filename); len(index) > 0 {
+		inputMs = NearestKeyframe(index, seekMs)
+		if !opts.FastSeek {
+			outputMs = seekMs - inputMs
+		}
+	}
+	seekMs = inputMs + outputMs
+	opts.logger().Info("streaming file", "file", filename, "position", FormatTimeMs(seekMs))
+	args, err := streamFileArgs(filename, inputMs, outputMs, output, opts)
 	if err != nil {
-		return nil, fmt.Errorf("stdout pipe: %w", err)
+		return nil, 0, err
 	}
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = &logWriter{logger: opts.logger()}
+
+	// a pipe of our own rather than StdoutPipe, which Wait closes, so the
+	// process can be reaped while the progress is still being read
+	stdout, pw, err := os.Pipe()
+	if err != nil {
+		return nil, 0, fmt.Errorf("stdout pipe: %w", err)
+	}
+	cmd.Stdout = pw
 
 	go func() {
-		// defer close(progressChan)
+		defer stdout.Close()
 
 		scanner := bufio.NewScanner(stdout)
 		currentMap := make(map[string]string)
@@ -109,16 +351,10 @@ func StreamFile(filename string, seekMs int, output string, run int, updates cha
 
 			if key == "progress" {
 				if value == "continue" {
-					// Create a new map to avoid reference issues
-					progressMap := make(map[string]string)
-					for k, v := range currentMap {
-						progressMap[k] = v
-					}
-
 					updates <- Update{
 						Run:      run,
 						SeekMs:   seekMs,
-						Progress: progressMap,
+						Progress: ParseProgress(currentMap),
 					}
 
 					currentMap = make(map[string]string)
@@ -129,11 +365,100 @@ func StreamFile(filename string, seekMs int, output string, run int, updates cha
 		}
 	}()
 
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	err = cmd.Start()
+	pw.Close()
+	if err != nil {
+		return nil, 0, err
 	}
 
-	return cmd, nil
+	return cmd, seekMs, nil
+}
+
+// streamFileArgs returns the arguments to stream filename from inputMs plus
+// outputMs. A keyframe at inputMs is seeked to directly, and the frames up to
+// outputMs after it are decoded in a burst rather than at the -re rate. With
+// no outputMs, the input is seeked to inputMs accurately.
+func streamFileArgs(filename string, inputMs, outputMs int, output string, opts Options) ([]string, error) {
+	seekMs := inputMs + outputMs
+	args := []string{
+		"-nostats",
+		"-progress", "pipe:1",
+		"-loglevel", "warning",
+		"-re",
+	}
+	if outputMs > 0 {
+		args = append(args,
+			"-readrate_initial_burst", formatSeconds(outputMs),
+			"-noaccurate_seek")
+	}
+	args = append(args,
+		"-ss", formatSeconds(inputMs),
+		"-i", filename)
+	if outputMs > 0 {
+		args = append(args, "-ss", formatSeconds(outputMs))
+	}
+	if opts.OSD != nil {
+		vf, err := opts.OSD.videoFilter(seekMs)
+		if err != nil {
+			return nil, fmt.Errorf("osd: %w", err)
+		}
+		args = append(args, "-vf", vf)
+	}
+	if af := opts.audioFilter(); af != "" {
+		args = append(args, "-af", af)
+	}
+	return append(args, outputArgs(output, "3M", "160k")...), nil
+}
+
+// TrackOutput returns an output that sends raw H.264 to videoAddr and
+// Ogg/Opus to audioAddr over TCP, for publishing as WebRTC tracks directly.
+func TrackOutput(videoAddr, audioAddr string) string {
+	return fmt.Sprintf("tcp://%s?audio=%s", videoAddr, audioAddr)
+}
+
+// outputArgs returns the encoding and muxing arguments for output, which is
+// an RTMP URL streamed as FLV, an HTTP URL published with WHIP, or a
+// TrackOutput split into separate video and audio streams.
+func outputArgs(output, videoBitrate, audioBitrate string) []string {
+	args := []string{
+		"-c:v", "libx264",
+		"-b:v", videoBitrate,
+		"-preset", "veryfast",
+	}
+	if strings.HasPrefix(output, "tcp://") {
+		u, err := url.Parse(output)
+		if err == nil {
+			return append(args,
+				"-tune", "zerolatency",
+				"-profile:v", "baseline",
+				"-bf", "0",
+				"-r", "30",
+				"-g", "60",
+				"-c:a", "libopus",
+				"-ar", "48000",
+				"-ac", "2",
+				"-b:a", audioBitrate,
+				"-f", "tee",
+				fmt.Sprintf("[f=h264:select=v:bsfs/v=h264_mp4toannexb]tcp://%s|[f=ogg:select=a:page_duration=20000]tcp://%s",
+					u.Host, u.Query().Get("audio")))
+		}
+	}
+	if strings.HasPrefix(output, "http") {
+		return append(args,
+			"-profile:v", "baseline",
+			"-bf", "0",
+			"-c:a", "libopus",
+			"-ar", "48000",
+			"-ac", "2",
+			"-b:a", audioBitrate,
+			"-f", "whip",
+			output)
+	}
+	return append(args,
+		"-c:a", "aac",
+		"-b:a", audioBitrate,
+		"-f", "flv",
+		output)
 }
 
 func MergeAV(videoFilename, audioFilename, outputFilename, title string) error {
@@ -197,6 +522,11 @@ func FormatTimeMs(ms int) string {
 	return fmt.Sprintf("%02d:%02d", m, s)
 }
 
+// formatSeconds returns milliseconds as seconds with millisecond precision.
+func formatSeconds(ms int) string {
+	return fmt.Sprintf("%d.%03d", ms/1000, ms%1000)
+}
+
 // parseTimeToMs parses a string like "00:00:00.166833" (HH:MM:SS.ssssss) into milliseconds.
 func ParseTimeToMs(timeStr string) (int, error) {
 	var h, m, s int
@@ -218,3 +548,29 @@ func ParseTimeToMs(timeStr string) (int, error) {
 	ms := int(frac/1000) + (h*3600+m*60+s)*1000
 	return ms, nil
 }
+
+// ParseGainDb parses a volume like "+3dB", "-6" (decibels) or "50%" into decibels.
+func ParseGainDb(gain string) (float64, error) {
+	s := strings.TrimSpace(strings.ToLower(gain))
+	var db float64
+	if pctStr, ok := strings.CutSuffix(s, "%"); ok {
+		pct, err := strconv.ParseFloat(pctStr, 64)
+		if err != nil || pct < 0 || math.IsNaN(pct) || math.IsInf(pct, 0) {
+			return 0, fmt.Errorf("invalid volume: %s", gain)
+		}
+		// 0% is -Inf dB, clamped to the quietest below
+		db = 20 * math.Log10(pct/100)
+	} else {
+		var err error
+		db, err = strconv.ParseFloat(strings.TrimSuffix(s, "db"), 64)
+		if err != nil || math.IsNaN(db) || math.IsInf(db, 0) {
+			return 0, fmt.Errorf("invalid volume: %s", gain)
+		}
+	}
+	return math.Max(-60, math.Min(20, db)), nil
+}
+
+// FormatGainDb returns a decibel value as a string like "+3.0dB".
+func FormatGainDb(db float64) string {
+	return fmt.Sprintf("%+.1fdB", db)
+}
@@ -0,0 +1,100 @@
+package ffmpeg
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStreamFileArgs(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		inputMs, outputMs int
+		opts              Options
+		want              []string
+		absent            []string
+	}{
+		{
+			name:   "start",
+			want:   []string{"-re -ss 0.000 -i tape.mp4", "-f flv rtmp://localhost/live"},
+			absent: []string{"-noaccurate_seek", "-readrate_initial_burst"},
+		},
+		{
+			name:    "accurate seek without an index",
+			inputMs: 61500,
+			want:    []string{"-re -ss 61.500 -i tape.mp4 -c:v"},
+			absent:  []string{"-noaccurate_seek", "-readrate_initial_burst"},
+		},
+		{
+			name:     "keyframe then decode",
+			inputMs:  60000,
+			outputMs: 1500,
+			want:     []string{"-re -readrate_initial_burst 1.500 -noaccurate_seek -ss 60.000 -i tape.mp4 -ss 1.500 -c:v"},
+		},
+		{
+			name:    "audio filters",
+			inputMs: 1000,
+			opts:    Options{Normalize: "loudnorm", GainDb: -3},
+			want:    []string{"-i tape.mp4 -af loudnorm=I=-16:TP=-1.5:LRA=11,volume=-3.0dB -c:v"},
+		},
+		{
+			name:    "osd",
+			inputMs: 1000,
+			opts:    Options{OSD: &OSD{Font: "font.ttf", Status: "PLAY", Seconds: 3}},
+			want:    []string{"-i tape.mp4 -vf drawtext=fontfile=font.ttf:"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := streamFileArgs("tape.mp4", tt.inputMs, tt.outputMs, "rtmp://localhost/live", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := strings.Join(args, " ")
+			for _, want := range tt.want {
+				if !strings.Contains(line, want) {
+					t.Errorf("args %q don't contain %q", line, want)
+				}
+			}
+			for _, absent := range tt.absent {
+				if slices.Contains(args, absent) {
+					t.Errorf("args %q contain %q", line, absent)
+				}
+			}
+		})
+	}
+}
+
+func TestParseGainDb(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "+3dB", want: 3},
+		{in: "-6", want: -6},
+		{in: " 2.5DB ", want: 2.5},
+		{in: "100%", want: 0},
+		{in: "10%", want: -20},
+		{in: "0%", want: -60},
+		{in: "+40", want: 20},
+		{in: "-100dB", want: -60},
+		{in: "loud", wantErr: true},
+		{in: "-5%", wantErr: true},
+		{in: "nan", wantErr: true},
+		{in: "NaN%", wantErr: true},
+		{in: "inf", wantErr: true},
+		{in: "-Inf", wantErr: true},
+		{in: "+infdB", wantErr: true},
+		{in: "Inf%", wantErr: true},
+	} {
+		got, err := ParseGainDb(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseGainDb(%q) err = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ParseGainDb(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var keyframes sync.Map
+
+// KeyframeIndex returns the sorted video keyframe times in milliseconds for
+// filename, probing it with ffprobe unless the index is already cached.
+func KeyframeIndex(filename string) ([]int, error) {
+	if index := CachedKeyframeIndex(filename); index != nil {
+		return index, nil
+	}
+	path, err := keyframeCachePath(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("ffprobe", "-v", "quiet",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		filename)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("probe keyframes: %w", err)
+	}
+	index := []int{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		pts, flags, ok := strings.Cut(scanner.Text(), ",")
+		if !ok || !strings.Contains(flags, "K") {
+			continue
+		}
+		sec, err := strconv.ParseFloat(pts, 64)
+		if err != nil {
+			continue
+		}
+		index = append(index, int(sec*1000))
+	}
+	sort.Ints(index)
+
+	b, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return nil, err
+	}
+	keyframes.Store(path, index)
+	return index, nil
+}
+
+// CachedKeyframeIndex returns the keyframe index for filename if it has
+// already been built, without probing the file.
+func CachedKeyframeIndex(filename string) []int {
+	path, err := keyframeCachePath(filename)
+	if err != nil {
+		return nil
+	}
+	if index, ok := keyframes.Load(path); ok {
+		return index.([]int)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var index []int
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil
+	}
+	keyframes.Store(path, index)
+	return index
+}
+
+// NearestKeyframe returns the last keyframe at or before ms.
+func NearestKeyframe(index []int, ms int) int {
+	i := sort.SearchInts(index, ms+1)
+	if i == 0 {
+		return 0
+	}
+	return index[i-1]
+}
+
+// keyframeCachePath is keyed on the file's path, size and modification time
+// so the index is rebuilt if the file changes.
+func keyframeCachePath(filename string) (string, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s:%d:%d", abs, fi.Size(), fi.ModTime().UnixNano())))
+	return filepath.Join(dir, "tapecafe", "keyframes", hex.EncodeToString(sum[:])+".json"), nil
+}
@@ -0,0 +1,28 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+)
+
+// logWriter logs each line of ffmpeg's stderr as a warning.
+type logWriter struct {
+	logger *slog.Logger
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.logger.Warn("ffmpeg", "output", line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
@@ -0,0 +1,51 @@
+package ffmpeg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Progress is one report from ffmpeg's -progress output. Values ffmpeg
+// reports as N/A are left zero, except OutTimeMs which is -1.
+type Progress struct {
+	Frame       int
+	FPS         float64
+	BitrateKbps float64
+	TotalSize   int64
+	OutTimeMs   int
+	DupFrames   int
+	DropFrames  int
+	Speed       float64
+	End         bool
+}
+
+// ParseProgress converts the key=value pairs of one progress report.
+func ParseProgress(kv map[string]string) Progress {
+	p := Progress{
+		Frame:       parseInt(kv["frame"]),
+		FPS:         parseFloat(kv["fps"]),
+		BitrateKbps: parseFloat(strings.TrimSuffix(kv["bitrate"], "kbits/s")),
+		DupFrames:   parseInt(kv["dup_frames"]),
+		DropFrames:  parseInt(kv["drop_frames"]),
+		Speed:       parseFloat(strings.TrimSuffix(kv["speed"], "x")),
+		End:         kv["progress"] == "end",
+		OutTimeMs:   -1,
+	}
+	p.TotalSize, _ = strconv.ParseInt(kv["total_size"], 10, 64)
+	if us, err := strconv.ParseInt(kv["out_time_us"], 10, 64); err == nil && us >= 0 {
+		p.OutTimeMs = int(us / 1000)
+	} else if ms, err := ParseTimeToMs(kv["out_time"]); err == nil && kv["out_time"] != "N/A" {
+		p.OutTimeMs = ms
+	}
+	return p
+}
+
+func parseInt(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f
+}
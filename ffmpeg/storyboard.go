@@ -0,0 +1,56 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+const maxStoryboardThumbs = 1000
+
+// Storyboard describes a sprite sheet of thumbnails taken every IntervalMs,
+// laid out left to right, top to bottom in a grid of Columns.
+type Storyboard struct {
+	IntervalMs int
+	Count      int
+	Columns    int
+	Rows       int
+	Width      int
+	Height     int
+}
+
+// GenerateStoryboard returns a JPEG sprite sheet of thumbnails of filename
+// taken every intervalSec, widening the interval for very long files.
+func GenerateStoryboard(filename string, durationMs, intervalSec int) ([]byte, Storyboard, error) {
+	sb := Storyboard{
+		IntervalMs: intervalSec * 1000,
+		Columns:    10,
+		Width:      160,
+		Height:     90,
+	}
+	if durationMs/sb.IntervalMs > maxStoryboardThumbs {
+		sb.IntervalMs = (durationMs/maxStoryboardThumbs/1000 + 1) * 1000
+	}
+	sb.Count = (durationMs + sb.IntervalMs - 1) / sb.IntervalMs
+	sb.Rows = (sb.Count + sb.Columns - 1) / sb.Columns
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("ffmpeg",
+		"-nostats",
+		"-loglevel", "quiet",
+		"-skip_frame", "nokey",
+		"-i", filename,
+		"-vf", fmt.Sprintf("fps=1000/%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+			sb.IntervalMs, sb.Width, sb.Height, sb.Width, sb.Height, sb.Columns, sb.Rows),
+		"-an",
+		"-frames:v", "1",
+		"-q:v", "5",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1")
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return nil, sb, fmt.Errorf("storyboard: %w", err)
+	}
+	return stdout.Bytes(), sb, nil
+}
@@ -11,8 +11,11 @@ require (
 	github.com/livekit/protocol v1.17.0
 	github.com/livekit/server-sdk-go v1.1.8
 	github.com/livekit/server-sdk-go/v2 v2.1.2
+	github.com/pion/webrtc/v3 v3.2.38
+	github.com/prometheus/client_golang v1.19.0
 	github.com/rs/xid v1.6.0
 	golang.ngrok.com/ngrok v1.13.0
+	golang.org/x/crypto v0.40.0
 	golang.org/x/net v0.42.0
 	tractor.dev/toolkit-go v0.0.0-20250103001615-9a6753936c19
 )
@@ -72,9 +75,7 @@ require (
 	github.com/pion/stun v0.6.1 // indirect
 	github.com/pion/transport/v2 v2.2.4 // indirect
 	github.com/pion/turn/v2 v2.1.3 // indirect
-	github.com/pion/webrtc/v3 v3.2.38 // indirect
 	github.com/pmezard/go-difflib v1.0.1-0.20181226105442-5d4384ee4fb2 // indirect
-	github.com/prometheus/client_golang v1.19.0 // indirect
 	github.com/prometheus/client_model v0.5.0 // indirect
 	github.com/prometheus/common v0.48.0 // indirect
 	github.com/prometheus/procfs v0.12.0 // indirect
@@ -90,7 +91,6 @@ require (
 	go.uber.org/zap v1.27.0 // indirect
 	go.uber.org/zap/exp v0.2.0 // indirect
 	golang.ngrok.com/muxado/v2 v2.0.1 // indirect
-	golang.org/x/crypto v0.40.0 // indirect
 	golang.org/x/exp v0.0.0-20250218142911-aa4b98e5adaa // indirect
 	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
@@ -0,0 +1,33 @@
+package server
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Ingress tunnel metrics, registered by the serve command.
+var (
+	IngressTunnels = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tapecafe_ingress_tunnels",
+		Help: "Ingress tunnel connections currently open.",
+	})
+	IngressTunnelsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tapecafe_ingress_tunnels_total",
+		Help: "Ingress tunnel connections opened.",
+	})
+	IngressTunnelErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tapecafe_ingress_tunnel_errors_total",
+		Help: "Ingress tunnel connections that ended with an error.",
+	})
+	IngressTunnelBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tapecafe_ingress_tunnel_bytes_total",
+		Help: "Bytes tunneled between casters and the ingress service.",
+	}, []string{"direction"})
+)
+
+// Collectors returns the metrics of this package.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		IngressTunnels,
+		IngressTunnelsTotal,
+		IngressTunnelErrors,
+		IngressTunnelBytes,
+	}
+}
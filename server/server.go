@@ -1,11 +1,16 @@
 package server
 
 import (
-	"io"
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/koding/websocketproxy"
 	"golang.org/x/net/websocket"
@@ -19,18 +24,62 @@ func ProxyRTC(w http.ResponseWriter, r *http.Request) {
 	websocketproxy.NewProxy(u).ServeHTTP(w, r)
 }
 
+// ProxyWHIP proxies /-/cast/whip/<stream-key> to the ingress service's
+// WHIP endpoint, rewriting the resource location it returns.
+func ProxyWHIP(w http.ResponseWriter, r *http.Request) {
+	u, _ := url.Parse("http://localhost:8080")
+	proxy := httputil.NewSingleHostReverseProxy(u)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.URL.Path = "/whip/" + strings.TrimPrefix(r.URL.Path, "/-/cast/whip/")
+		r.Host = u.Host
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		if loc := resp.Header.Get("Location"); strings.HasPrefix(loc, "/whip/") {
+			resp.Header.Set("Location", "/-/cast/whip/"+strings.TrimPrefix(loc, "/whip/"))
+		}
+		return nil
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// HandleIngress tunnels a caster's RTMP stream to the ingress service.
+// Failures end only this connection and are reported back to the caster.
 func HandleIngress(conn *websocket.Conn) {
 	conn.PayloadType = websocket.BinaryFrame
-	log.Println("New cast connection")
-	c, err := net.Dial("tcp", "localhost:1935")
+	room := conn.Request().URL.Query().Get("room")
+	logger := slog.With("room", room, "remote", conn.Request().RemoteAddr)
+	logger.Info("ingress tunnel opened")
+	c, err := net.DialTimeout("tcp", "localhost:1935", 5*time.Second)
 	if err != nil {
-		log.Fatal("dial:", err)
+		IngressTunnelErrors.Inc()
+		logger.Error("ingress dial", "err", err)
+		ReportError(conn, fmt.Errorf("dial ingress: %w", err))
+		conn.Close()
+		return
+	}
+	t := &Tunnel{
+		ReadTimeout:   30 * time.Second,
+		WriteTimeout:  10 * time.Second,
+		SentBytes:     IngressTunnelBytes.WithLabelValues("out"),
+		ReceivedBytes: IngressTunnelBytes.WithLabelValues("in"),
 	}
-	defer c.Close()
-	go io.Copy(conn, c)
-	_, err = io.Copy(c, conn)
+	// the request context is canceled when the server shuts down
+	stop := context.AfterFunc(conn.Request().Context(), func() {
+		ReportError(conn, errors.New("server shutting down"))
+		conn.Close()
+	})
+	defer stop()
+	IngressTunnels.Inc()
+	IngressTunnelsTotal.Inc()
+	err = t.Run(conn, c)
+	IngressTunnels.Dec()
+	logger = logger.With("bytes_in", t.Received.Load(), "bytes_out", t.Sent.Load())
 	if err != nil {
-		log.Println("copy:", err)
+		IngressTunnelErrors.Inc()
+		logger.Error("ingress tunnel", "err", err)
 		return
 	}
+	logger.Info("ingress tunnel closed")
 }
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/websocket"
+)
+
+// The ingress tunnel carries RTMP bytes over a websocket in binary frames.
+// Text frames are control messages: "eof" half-closes the direction it
+// arrives on, anything else is an error from the other end.
+const (
+	tunnelEOF    = "eof"
+	tunnelLinger = 5 * time.Second
+)
+
+type frame struct {
+	payloadType byte
+	data        []byte
+}
+
+var frameCodec = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		f := v.(frame)
+		return f.data, f.payloadType, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		f := v.(*frame)
+		f.payloadType = payloadType
+		f.data = data
+		return nil
+	},
+}
+
+// remoteError is an error reported by the other end of a tunnel.
+type remoteError string
+
+func (e remoteError) Error() string {
+	return "remote: " + string(e)
+}
+
+// Tunnel copies between a websocket and a TCP connection in both directions
+// until both sides have finished or either fails.
+type Tunnel struct {
+	// ReadTimeout, if set, fails the tunnel when nothing arrives over the
+	// websocket for that long.
+	ReadTimeout time.Duration
+	// WriteTimeout, if set, bounds each write to either side.
+	WriteTimeout time.Duration
+
+	// Sent and Received count bytes written to and read from the websocket.
+	Sent     atomic.Int64
+	Received atomic.Int64
+	// SentBytes and ReceivedBytes, if set, also count them.
+	SentBytes     prometheus.Counter
+	ReceivedBytes prometheus.Counter
+
+	errOnce sync.Once
+}
+
+// Run tunnels conn over ws, reporting errors to the other end before
+// closing both. It returns the first error from either direction.
+func (t *Tunnel) Run(ws *websocket.Conn, conn net.Conn) error {
+	errs := make(chan error, 2)
+	go func() { errs <- t.send(ws, conn) }()
+	go func() { errs <- t.receive(ws, conn) }()
+
+	var (
+		err     error
+		linger  <-chan time.Time
+		expired bool
+	)
+	for done := 0; done < 2; {
+		select {
+		case e := <-errs:
+			done++
+			if e == nil {
+				// the other direction gets a moment to finish on its own
+				linger = time.After(tunnelLinger)
+				continue
+			}
+			if err == nil && !expired {
+				err = e
+				if _, ok := err.(remoteError); !ok {
+					t.fail(ws, err)
+				}
+			}
+		case <-linger:
+			linger, expired = nil, true
+		}
+		ws.Close()
+		conn.Close()
+	}
+	ws.Close()
+	conn.Close()
+	return err
+}
+
+// send copies conn to ws, then tells the other end there is nothing more.
+func (t *Tunnel) send(ws *websocket.Conn, conn net.Conn) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			if err := t.write(ws, frame{websocket.BinaryFrame, buf[:n]}); err != nil {
+				return err
+			}
+			t.Sent.Add(int64(n))
+			if t.SentBytes != nil {
+				t.SentBytes.Add(float64(n))
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return t.write(ws, frame{websocket.TextFrame, []byte(tunnelEOF)})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receive copies ws to conn until the other end sends eof or an error.
+func (t *Tunnel) receive(ws *websocket.Conn, conn net.Conn) error {
+	for {
+		if t.ReadTimeout > 0 {
+			ws.SetReadDeadline(time.Now().Add(t.ReadTimeout))
+		}
+		var f frame
+		if err := frameCodec.Receive(ws, &f); err != nil {
+			return err
+		}
+		if f.payloadType == websocket.TextFrame {
+			if string(f.data) != tunnelEOF {
+				return remoteError(f.data)
+			}
+			if c, ok := conn.(interface{ CloseWrite() error }); ok {
+				return c.CloseWrite()
+			}
+			return nil
+		}
+		if t.WriteTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+		}
+		if _, err := conn.Write(f.data); err != nil {
+			return err
+		}
+		t.Received.Add(int64(len(f.data)))
+		if t.ReceivedBytes != nil {
+			t.ReceivedBytes.Add(float64(len(f.data)))
+		}
+	}
+}
+
+func (t *Tunnel) write(ws *websocket.Conn, f frame) error {
+	if t.WriteTimeout > 0 {
+		ws.SetWriteDeadline(time.Now().Add(t.WriteTimeout))
+	}
+	return frameCodec.Send(ws, f)
+}
+
+// fail reports err to the other end once, best effort.
+func (t *Tunnel) fail(ws *websocket.Conn, err error) {
+	t.errOnce.Do(func() {
+		t.write(ws, frame{websocket.TextFrame, []byte(err.Error())})
+	})
+}
+
+// ReportError sends err to the other end of a tunnel that never started.
+func ReportError(ws *websocket.Conn, err error) {
+	var t Tunnel
+	t.WriteTimeout = 5 * time.Second
+	t.fail(ws, err)
+}
@@ -0,0 +1,157 @@
+// Package supervisor runs child processes, starting them in order once the
+// previous one is ready, restarting them when they exit and prefixing their
+// output with their name.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// minUptime is how long a process must run for its restart delay to reset.
+	minUptime = 30 * time.Second
+	// maxRestartDelay caps the backoff between restarts.
+	maxRestartDelay = 30 * time.Second
+	// stopTimeout is how long a process gets to exit after SIGTERM.
+	stopTimeout = 5 * time.Second
+)
+
+// Process is a program kept running by a Supervisor.
+type Process struct {
+	Name string
+	Path string
+	Args []string
+	Dir  string
+	// Ready, if set, reports whether the process is up. The next process
+	// is started once it succeeds.
+	Ready func(ctx context.Context) error
+	// StartTimeout bounds waiting for Ready, 30 seconds if zero.
+	StartTimeout time.Duration
+}
+
+// Supervisor keeps its processes running until the context passed to Start
+// is done.
+type Supervisor struct {
+	Processes []Process
+	// Output receives the processes' output, each line prefixed with the
+	// process name. os.Stderr if nil.
+	Output io.Writer
+
+	wg sync.WaitGroup
+	mu sync.Mutex
+}
+
+// Start starts the processes in order, waiting for each to be ready before
+// starting the next. Once ctx is done the processes are stopped, see Wait.
+func (s *Supervisor) Start(ctx context.Context) error {
+	out := s.Output
+	if out == nil {
+		out = os.Stderr
+	}
+	width := 0
+	for _, p := range s.Processes {
+		width = max(width, len(p.Name))
+	}
+	for _, p := range s.Processes {
+		path, err := exec.LookPath(p.Path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		p.Path = path
+		w := &prefixWriter{
+			prefix: []byte(fmt.Sprintf("%-*s | ", width, p.Name)),
+			out:    out,
+			mu:     &s.mu,
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.keepRunning(ctx, p, w)
+		}()
+		if err := waitReady(ctx, p); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+		slog.Info("process ready", "process", p.Name)
+	}
+	return nil
+}
+
+// Wait blocks until every process has been stopped.
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Supervisor) keepRunning(ctx context.Context, p Process, w *prefixWriter) {
+	delay := time.Second
+	for {
+		cmd := exec.Command(p.Path, p.Args...)
+		cmd.Dir = p.Dir
+		cmd.Stdout = w
+		cmd.Stderr = w
+		started := time.Now()
+		if err := cmd.Start(); err != nil {
+			slog.Error("process start", "process", p.Name, "err", err)
+		} else {
+			slog.Debug("process started", "process", p.Name, "pid", cmd.Process.Pid)
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+			select {
+			case err := <-exited:
+				if time.Since(started) > minUptime {
+					delay = time.Second
+				}
+				slog.Warn("process exited, restarting", "process", p.Name, "err", err, "delay", delay)
+			case <-ctx.Done():
+				cmd.Process.Signal(syscall.SIGTERM)
+				select {
+				case <-exited:
+				case <-time.After(stopTimeout):
+					cmd.Process.Kill()
+					<-exited
+				}
+				w.Flush()
+				slog.Debug("process stopped", "process", p.Name)
+				return
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+func waitReady(ctx context.Context, p Process) error {
+	if p.Ready == nil {
+		return nil
+	}
+	timeout := p.StartTimeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		err := p.Ready(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("not ready: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -6,3 +6,6 @@ import (
 
 //go:embed dist
 var Dir embed.FS
+
+//go:embed assets/vcrosdmono.ttf
+var OSDFont []byte
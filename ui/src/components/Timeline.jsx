@@ -5,7 +5,8 @@ function Timeline({ url, onSendMessage }) {
     title: '',
     currentTime: 0,
     totalTime: 0,
-    playing: false
+    playing: false,
+    storyboard: null
   })
   const [hoverTime, setHoverTime] = useState(null)
   const [hoverPosition, setHoverPosition] = useState(0)
@@ -29,7 +30,8 @@ function Timeline({ url, onSendMessage }) {
           title: update.Title || '',
           currentTime: update.PositionMs || 0,
           totalTime: update.LengthMs || 0,
-          playing: update.Status === '' // Empty status means playing
+          playing: update.Status === '', // Empty status means playing
+          storyboard: update.Storyboard || null
         })
       } catch (error) {
         console.error('Failed to parse state data:', error)
@@ -62,6 +64,22 @@ function Timeline({ url, onSendMessage }) {
     return `${minutes.toString().padStart(2, '0')}:${secs.toString().padStart(2, '0')}`
   }
 
+  // Storyboard sprite offset for a time, if the caster generated one
+  const storyboardFrame = (time) => {
+    const sb = timelineState.storyboard
+    if (!sb || !sb.Count) return null
+    const i = Math.min(Math.floor(time / sb.IntervalMs), sb.Count - 1)
+    const base = new URL(url)
+    base.protocol = base.protocol.replace('ws', 'http')
+    return {
+      width: sb.Width,
+      height: sb.Height,
+      image: new URL(sb.URL, base).toString(),
+      x: (i % sb.Columns) * sb.Width,
+      y: Math.floor(i / sb.Columns) * sb.Height
+    }
+  }
+
   // Don't render if we don't have valid timeline data
   if (timelineState.totalTime === 0) {
     return null
@@ -175,6 +193,18 @@ function Timeline({ url, onSendMessage }) {
               zIndex: 1000,
               boxShadow: '0 2px 4px rgba(0, 0, 0, 0.3)'
             }}>
+              {(() => {
+                const frame = storyboardFrame(hoverTime)
+                return frame && (
+                  <div style={{
+                    width: `${frame.width}px`,
+                    height: `${frame.height}px`,
+                    marginBottom: '4px',
+                    backgroundImage: `url("${frame.image}")`,
+                    backgroundPosition: `-${frame.x}px -${frame.y}px`
+                  }} />
+                )
+              })()}
               {formatTime(hoverTime)}
             </div>
           )}